@@ -1,14 +1,16 @@
 package account
 
 import (
+	"bookateriago/audit"
+	"bookateriago/binding"
 	"bookateriago/core"
+	emails "bookateriago/email"
+	"bookateriago/i18n"
 	"bookateriago/log"
-	"context"
+	"bookateriago/pagination"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
@@ -17,127 +19,107 @@ import (
 	"gorm.io/gorm"
 )
 
-var (
-	db          = InitDatabase()
-	viperConfig = core.ReadViper()
-	redisDB, _  = strconv.Atoi(fmt.Sprintf("%s", viperConfig.Get("redis.database")))
-	redisClient = redis.NewClient(&redis.Options{
-		Addr: fmt.Sprintf("%s", viperConfig.Get("redis.address")),
-		//Password: fmt.Sprintf("%s", viperConfig.Get("redis.password")),
-		DB: redisDB,
-	})
-	ctx = context.Background()
-)
+// handler serves the account routes: users in the database, OTPs in Redis and the emails sent about them
+type handler struct {
+	db       *gorm.DB
+	redis    *redis.Client
+	sessions *core.Sessions
+	emails   *emails.Queue
+}
 
 // otp is the structure of the OTP itself
 type otp struct {
-	Email string `json:"email"`
-	Pin   string `json:"pin"`
+	Email string `json:"email" validate:"required,email"`
+	Pin   string `json:"pin" validate:"required"`
 }
 
 // otpRequest carries parameters for requesting OTPs
 type otpRequest struct {
-	Email string `json:"email"`
+	Email string `json:"email" validate:"required,email"`
 }
 
-// allUsers gets and returns a list of all users in the DB
-func allUsers(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// signUpRequest is what a new user sends to create an account
+type signUpRequest struct {
+	UserName string `json:"user_name" validate:"required,max=50"`
+	FullName string `json:"full_name" validate:"required,max=100"`
+	Alias    string `json:"alias" validate:"required,max=50"`
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required,max=128"`
+	// Language is optional, unsupported ones fall back to Accept-Language
+	Language string `json:"language"`
+}
+
+// allUsers gets and returns a page of all users in the DB
+func (h *handler) allUsers(w http.ResponseWriter, r *http.Request) {
 	var users []User
-	db.Scopes(Paginate(r)).Find(&users)
-	err := json.NewEncoder(w).Encode(users)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
-	return
+	pagination.List(w, r, h.db.WithContext(r.Context()).Model(&User{}), &users)
 }
 
 // getUser returns a user by id. TODO change to by slug
-func getUser(w http.ResponseWriter, r *http.Request) {
+func (h *handler) getUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var user User
 	params := mux.Vars(r)
 	userID := params["id"]
-	db.Find(&user, "id = ?", userID)
+	h.db.WithContext(r.Context()).Find(&user, "id = ?", userID)
 	err := json.NewEncoder(w).Encode(user)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	log.ErrorContext(r.Context(), err)
 	return
 }
 
 // postUser for creating a new user. Does all the checks.
-func postUser(w http.ResponseWriter, r *http.Request) {
+func (h *handler) postUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var user User
-	err := json.NewDecoder(r.Body).Decode(&user)
-	log.ErrorHandler(err)
+	var body signUpRequest
+	if !binding.JSON(w, r, &body) {
+		return
+	}
 	var (
-		email         = strings.ToLower(user.Email)
-		alias         = user.Alias
-		userName      = user.UserName
-		password      = user.Password
-		fullName      = user.FullName
-		safeNames     bool
-		safeEmail     = emailValidator(email)
+		email         = strings.ToLower(body.Email)
+		alias         = strings.Join(strings.Fields(body.Alias), " ")
+		userName      = strings.TrimSpace(body.UserName)
+		password      = body.Password
+		fullName      = strings.Join(strings.Fields(body.FullName), " ")
+		safeEmail     = emailValidator(r.Context(), email)
 		safePassword  = passwordValidator(password)
 		similarToUser = similarToUser(fullName, alias, userName, password)
 	)
 
-	duplicateEmail := DuplicateCheck(email)
+	duplicateEmail := h.DuplicateCheck(r.Context(), email)
 
 	if duplicateEmail {
-		w.WriteHeader(http.StatusConflict)
-		err := json.NewEncoder(w).Encode(core.FourONine)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 409)
-		return
-	}
-
-	safeNames = userDetails(fullName, alias, userName)
-
-	if safeNames {
-		// Some or all of the details in the body are empty
-		//	All fields are required
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		err := json.NewEncoder(w).Encode(core.FourTwoTwo)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 422)
+		core.WriteProblem(w, r, core.FourONine, core.Field("email", "taken"))
 		return
 	}
 
+	// The email and password are checked together, so the user gets to fix both in one go
+	var invalid []core.FieldError
 	if !safeEmail {
-		// Issue with Email
-		//Email couldn't be verified  or invalid email
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		err := json.NewEncoder(w).Encode(core.FourTwoTwo)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 422)
-		return
+		// Email couldn't be verified or invalid email
+		invalid = append(invalid, core.Field("email", "invalid"))
 	}
-
 	if similarToUser {
-		// Issue with Password
-		// Password is similar to user information
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		err := json.NewEncoder(w).Encode(core.FourTwoTwo)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 422)
-		return
+		invalid = append(invalid, core.Field("password", "similar_to_user"))
+	} else if !safePassword {
+		// Password doesn't go through the validator successfully
+		invalid = append(invalid, core.Field("password", "weak"))
 	}
 
-	if !safePassword {
-		// Issue with Password
-		//	Password doesn't go through the validator successfully
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		err := json.NewEncoder(w).Encode(core.FourTwoTwo)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 422)
+	if len(invalid) > 0 {
+		core.WriteProblem(w, r, core.FourTwoTwo, invalid...)
 		return
 	}
 
 	passwordHash, err := generatePasswordHash(password)
-	log.ErrorHandler(err)
+	log.ErrorContext(r.Context(), err)
 
-	user = User{
+	// Emails go out in the language picked at sign up, or the one the browser asks for
+	language := strings.ToLower(body.Language)
+	if !i18n.Supported(language) {
+		language = i18n.FromRequest(r)
+	}
+
+	user := User{
 		UserName:        userName,
 		FullName:        fullName,
 		Alias:           alias,
@@ -147,92 +129,102 @@ func postUser(w http.ResponseWriter, r *http.Request) {
 		LastLogin:       time.Time{},
 		IsActive:        false,
 		IsEmailVerified: false,
+		Language:        language,
 	}
 
 	//	fmt.Println("Create The Fucking User Here")
 
-	db.Create(&user)
+	err = h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Create, EntityType: "user", EntityID: user.ID, After: user,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
 	err = json.NewEncoder(w).Encode(user)
-	log.ErrorHandler(err)
+	log.ErrorContext(r.Context(), err)
 
 	// Create OTP to verify email by
 	// OTP expires in 30 minutes
 	// Stored in Redis with key new_user_otp_email
 	verifiableToken := generateOTP()
-	err = redisClient.Set(ctx, "new_user_otp_"+email, verifiableToken, 30*time.Minute).Err()
-	log.ErrorHandler(err)
-
-	//payload := struct {
-	//	Token string
-	//}{
-	//	Token: verifiableToken,
-	//}
-	//
-	//var status bool
-	//
-	////status, err = core.SendEmailNoAttachment(email, "OTP for Verification", payload, "token.txt")
-	//if !status {
-	//	w.WriteHeader(http.StatusInternalServerError)
-	//	err = json.NewEncoder(w).Encode(core.FiveHundred)
-	//	log.ErrorHandler(err)
-	//	log.AccessHandler(r, 500)
-	//	return
-	//}
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	err = h.redis.Set(r.Context(), "new_user_otp_"+email, verifiableToken, 30*time.Minute).Err()
+	log.ErrorContext(r.Context(), err)
+
+	payload := struct {
+		Token string
+	}{
+		Token: verifiableToken,
+	}
+
+	// The user is created either way. If the mail doesn't go out, a new OTP can be requested
+	err = h.emails.SendEmailNoAttachment(email, user.Language, payload, "token")
+	log.ErrorContext(r.Context(), err)
 	return
 }
 
 // verifyEmail is used to verify emails and make sure they exists.
 // Supplementary to the regex check and the MX lookup
-func verifyEmail(w http.ResponseWriter, r *http.Request) {
+func (h *handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var (
 		data otp
 		user User
 	)
-	err := json.NewDecoder(r.Body).Decode(&data)
-	log.ErrorHandler(err)
+	if !binding.JSON(w, r, &data) {
+		return
+	}
 
 	// Gets the user and checks if the mail is already verified
-	db.Find(&user, "email = ?", strings.ToLower(data.Email))
+	h.db.WithContext(r.Context()).Find(&user, "email = ?", strings.ToLower(data.Email))
 	if user.IsEmailVerified {
-		w.WriteHeader(http.StatusBadRequest)
-		err = json.NewEncoder(w).Encode(core.FourHundred)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 400)
+		core.WriteProblem(w, r, core.FourHundred, core.Field("email", "already_verified"))
 		return
 	}
 
 	// Gets the OTP stored in redis
-	var storedOTP string
 	key := "new_user_otp_" + data.Email
-	storedOTP, err = redisClient.Get(ctx, key).Result()
-	log.ErrorHandler(err)
+	storedOTP, err := h.redis.Get(r.Context(), key).Result()
+	log.ErrorContext(r.Context(), err)
 
 	// If the OTP is empty, or the key doesn't exist or the pin provided is incorrect,
 	// the pin has either elapsed the 30 minutes given or just plain wrong
 	// So they need to request a new one
 	if storedOTP == "" || storedOTP != data.Pin {
-		w.WriteHeader(http.StatusUnauthorized)
-		err = json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	before := audit.Snapshot(user)
 	user.IsEmailVerified = true
-	db.Save(&user)
-	log.AccessHandler(r, 200)
+	err = h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: user.Email, Action: audit.Update, EntityType: "user", EntityID: user.ID, Before: before, After: user,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
 
-	redisClient.Del(ctx, key)
+	h.redis.Del(r.Context(), key)
 	return
 
 }
 
 // requestOTP : In case the OTP sent expires, users can request for a new OTP
-func requestOTP(w http.ResponseWriter, r *http.Request) {
+func (h *handler) requestOTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var (
 		data      otpRequest
@@ -240,17 +232,19 @@ func requestOTP(w http.ResponseWriter, r *http.Request) {
 		user      User
 	)
 
-	err := json.NewDecoder(r.Body).Decode(&data)
+	if !binding.JSON(w, r, &data) {
+		return
+	}
 
-	db.Find(&user, "email = ?", data.Email)
+	h.db.WithContext(r.Context()).Find(&user, "email = ?", data.Email)
 	key := "new_user_otp_" + data.Email
-	storedOTP, err = redisClient.Get(ctx, key).Result()
+	storedOTP, err := h.redis.Get(r.Context(), key).Result()
 
-	log.ErrorHandler(err)
+	log.ErrorContext(r.Context(), err)
 
 	if storedOTP == "" {
 		verifiableToken := generateOTP()
-		err = redisClient.Set(ctx, key, verifiableToken, 30*time.Minute).Err()
+		err = h.redis.Set(r.Context(), key, verifiableToken, 30*time.Minute).Err()
 		storedOTP = verifiableToken
 	}
 
@@ -259,49 +253,38 @@ func requestOTP(w http.ResponseWriter, r *http.Request) {
 	}{
 		Token: storedOTP,
 	}
-	var status bool
-	status, err = core.SendEmailNoAttachment(data.Email, "OTP for Verification", payload, "token.txt")
-	if !status {
-		log.ErrorHandler(err)
-		w.WriteHeader(http.StatusInternalServerError)
-		err = json.NewEncoder(w).Encode(core.FiveHundred)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 500)
+	err = h.emails.SendEmailNoAttachment(data.Email, preferredLanguage(user, r), payload, "token")
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
-	log.AccessHandler(r, 200)
 	return
 
 }
 
 // resetPasswordRequest handles the request to reset a password. Sends a mail to the user, containing the OTP
-func resetPasswordRequest(w http.ResponseWriter, r *http.Request) {
+func (h *handler) resetPasswordRequest(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var body otpRequest
-
-	err := json.NewDecoder(r.Body).Decode(&body)
-	log.ErrorHandler(err)
+	if !binding.JSON(w, r, &body) {
+		return
+	}
 
 	// Verify email
-	emailStatus := emailValidator(body.Email)
+	emailStatus := emailValidator(r.Context(), body.Email)
 	if !emailStatus {
-		w.WriteHeader(http.StatusBadRequest)
-		err = json.NewEncoder(w).Encode(core.FourHundred)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 400)
+		core.WriteProblem(w, r, core.FourHundred, core.Field("email", "invalid"))
 		return
 	}
 
 	var count int64
 	var user User
-	db.Find(&user, "email = ?", body.Email).Count(&count)
+	h.db.WithContext(r.Context()).Find(&user, "email = ?", body.Email).Count(&count)
 
 	if count <= 0 {
-		w.WriteHeader(http.StatusUnauthorized)
-		err = json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
@@ -313,13 +296,10 @@ func resetPasswordRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// save token to redis
-	err = redisClient.Set(ctx, "password_reset_"+data.Email, data.Pin, 30*time.Minute).Err()
+	err := h.redis.Set(r.Context(), "password_reset_"+data.Email, data.Pin, 30*time.Minute).Err()
 	if err != nil {
-		log.ErrorHandler(err)
-		w.WriteHeader(http.StatusInternalServerError)
-		err := json.NewEncoder(w).Encode(core.FiveHundred)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 500)
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
 		return
 	}
 
@@ -330,86 +310,280 @@ func resetPasswordRequest(w http.ResponseWriter, r *http.Request) {
 		Token: data.Pin,
 	}
 
-	status, err := core.SendEmailNoAttachment(data.Email, "Reset Password", payload, "password_reset.txt")
-	if !status {
-		log.ErrorHandler(err)
-		w.WriteHeader(http.StatusInternalServerError)
-		err = json.NewEncoder(w).Encode(core.FiveHundred)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 500)
+	err = h.emails.SendEmailNoAttachment(data.Email, preferredLanguage(user, r), payload, "password_reset")
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
 		return
 	}
 
 	// respond okay
 	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(core.TwoHundred)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	err = json.NewEncoder(w).Encode(core.Localize(r, core.TwoHundred))
+	log.ErrorContext(r.Context(), err)
 	return
 }
 
 // resetPassword actually resets the users password. Based on data provided and generated
-func resetPassword(w http.ResponseWriter, r *http.Request) {
+func (h *handler) resetPassword(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// take email, token and new password
 	body := struct {
-		Email    string `json:"email"`
-		OTP      string `json:"otp"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required,email"`
+		OTP      string `json:"otp" validate:"required"`
+		Password string `json:"password" validate:"required,max=128"`
 	}{}
-
-	err := json.NewDecoder(r.Body).Decode(&body)
-	log.ErrorHandler(err)
+	if !binding.JSON(w, r, &body) {
+		return
+	}
 
 	// check email for existence
 	var user User
-	err = db.Find(&user, "email = ?", body.Email).Error
+	err := h.db.WithContext(r.Context()).Find(&user, "email = ?", body.Email).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		w.WriteHeader(http.StatusUnauthorized)
-		log.ErrorHandler(err)
-		err = json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
 	// check if token exists
-	storedOtp, err := redisClient.Get(ctx, "password_reset_"+body.Email).Result()
-	log.ErrorHandler(err)
+	storedOtp, err := h.redis.Get(r.Context(), "password_reset_"+body.Email).Result()
+	log.ErrorContext(r.Context(), err)
 
 	if storedOtp != body.OTP {
-		w.WriteHeader(http.StatusUnauthorized)
-		err = json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
 	// validate password
 	safePassword := passwordValidator(body.Password)
 	if !safePassword {
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		err = json.NewEncoder(w).Encode(core.FourTwoTwo)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 422)
+		core.WriteProblem(w, r, core.FourTwoTwo, core.Field("password", "weak"))
 		return
 	}
 
 	// Generate password hash and save
 	hashedPassword, err := generatePasswordHash(body.Password)
-	log.ErrorHandler(err)
+	log.ErrorContext(r.Context(), err)
 
+	before := audit.Snapshot(user)
 	user.Password = hashedPassword
-	db.Save(&user)
+	err = h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: user.Email, Action: audit.Update, EntityType: "user", EntityID: user.ID, Before: before, After: user,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(core.TwoHundred)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	err = json.NewEncoder(w).Encode(core.Localize(r, core.TwoHundred))
+	log.ErrorContext(r.Context(), err)
 
 	// Delete from redis
-	redisClient.Del(ctx, "password_reset_"+body.Email)
+	h.redis.Del(r.Context(), "password_reset_"+body.Email)
+
+	return
+}
+
+// deleteUser soft deletes the logged in user. The account is hidden and can no longer sign in,
+// but can be restored by the owner until the deletion grace period runs out.
+func (h *handler) deleteUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, email := h.sessions.GetTokenEmail(r)
+	if email == "" {
+		core.WriteProblem(w, r, core.FourOOne)
+		return
+	}
+
+	// The password is required again so a stolen token alone can't delete an account
+	body := struct {
+		Password string `json:"password" validate:"required"`
+	}{}
+	if !binding.JSON(w, r, &body) {
+		return
+	}
+
+	var user User
+	h.db.WithContext(r.Context()).Find(&user, "email = ?", strings.ToLower(email))
+	correct, _ := ComparePassword(body.Password, user.Password)
+	if user.ID == 0 || !correct {
+		core.WriteProblem(w, r, core.FourOOne)
+		return
+	}
+
+	err := h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: user.Email, Action: audit.Delete, EntityType: "user", EntityID: user.ID, Before: user,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
+
+	// Log the user out everywhere
+	h.redis.Del(r.Context(), user.Email)
 
+	gracePeriod := deletionGracePeriod()
+	payload := struct {
+		Days     int
+		PurgesOn string
+	}{
+		Days:     int(gracePeriod.Hours() / 24),
+		PurgesOn: time.Now().Add(gracePeriod).Format("January 2, 2006"),
+	}
+	err = h.emails.SendEmailNoAttachment(user.Email, preferredLanguage(user, r), payload, "account_deleted")
+	log.ErrorContext(r.Context(), err)
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(core.Localize(r, core.TwoHundred))
+	log.ErrorContext(r.Context(), err)
+	return
+}
+
+// requestRestore sends an OTP to the owner of a deleted account that is still within the grace period
+func (h *handler) requestRestore(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var body otpRequest
+	if !binding.JSON(w, r, &body) {
+		return
+	}
+	email := strings.ToLower(body.Email)
+
+	user, found := h.restorableUser(r.Context(), email)
+	if !found {
+		core.WriteProblem(w, r, core.FourOFour)
+		return
+	}
+
+	pin := generateOTP()
+	err := h.redis.Set(r.Context(), "account_restore_"+user.Email, pin, 30*time.Minute).Err()
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
+
+	payload := struct {
+		Token string
+	}{
+		Token: pin,
+	}
+	err = h.emails.SendEmailNoAttachment(user.Email, preferredLanguage(user, r), payload, "account_restore")
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(core.Localize(r, core.TwoHundred))
+	log.ErrorContext(r.Context(), err)
+	return
+}
+
+// restoreUser brings back a soft deleted account once the emailed OTP is confirmed
+func (h *handler) restoreUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var data otp
+	if !binding.JSON(w, r, &data) {
+		return
+	}
+	email := strings.ToLower(data.Email)
+
+	user, found := h.restorableUser(r.Context(), email)
+	if !found {
+		core.WriteProblem(w, r, core.FourOFour)
+		return
+	}
+
+	key := "account_restore_" + user.Email
+	storedOTP, err := h.redis.Get(r.Context(), key).Result()
+	log.ErrorContext(r.Context(), err)
+
+	if storedOTP == "" || storedOTP != data.Pin {
+		core.WriteProblem(w, r, core.FourOOne)
+		return
+	}
+
+	// The deletion time isn't in the JSON of a user, so it is recorded on its own
+	err = h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&user).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: user.Email, Action: audit.Update, EntityType: "user", EntityID: user.ID,
+			Before: map[string]interface{}{"deleted_at": user.DeletedAt.Time}, After: map[string]interface{}{"deleted_at": nil},
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
+	h.redis.Del(r.Context(), key)
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(core.Localize(r, core.TwoHundred))
+	log.ErrorContext(r.Context(), err)
 	return
 }
+
+// updateLanguage changes the language the logged in user gets emails in
+func (h *handler) updateLanguage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, email := h.sessions.GetTokenEmail(r)
+	if email == "" {
+		core.WriteProblem(w, r, core.FourOOne)
+		return
+	}
+
+	body := struct {
+		Language string `json:"language" validate:"required"`
+	}{}
+	if !binding.JSON(w, r, &body) {
+		return
+	}
+
+	language := strings.ToLower(body.Language)
+	if !i18n.Supported(language) {
+		core.WriteProblem(w, r, core.FourTwoTwo, core.Field("language", "unsupported"))
+		return
+	}
+
+	var user User
+	h.db.WithContext(r.Context()).Find(&user, "email = ?", strings.ToLower(email))
+	if user.ID == 0 {
+		core.WriteProblem(w, r, core.FourOFour)
+		return
+	}
+	before := audit.Snapshot(user)
+	err := h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("language", language).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: user.Email, Action: audit.Update, EntityType: "user", EntityID: user.ID, Before: before, After: user,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(user)
+	log.ErrorContext(r.Context(), err)
+}
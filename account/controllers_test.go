@@ -0,0 +1,202 @@
+package account
+
+import (
+	"bookateriago/core"
+	emails "bookateriago/email"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const testKey = "secret"
+
+func TestMain(m *testing.M) {
+	os.Setenv("BOOKATERIA_SETTINGS_KEY", testKey)
+	os.Exit(m.Run())
+}
+
+// newTestHandler serves from a mocked database, with sessions, OTPs and the email queue in an in-memory Redis
+func newTestHandler(t *testing.T) (*handler, sqlmock.Sqlmock, *miniredis.Miniredis) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		server.Close()
+	})
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	return &handler{
+		db:       db,
+		redis:    client,
+		sessions: core.NewSessions(client),
+		emails:   emails.NewQueue(client, nil),
+	}, mock, server
+}
+
+// signIn hands out a token for email the way auth does
+func signIn(t *testing.T, server *miniredis.Miniredis, email string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"email": email,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(testKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = server.Set(email, token); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestUpdateLanguageMissingUser(t *testing.T) {
+	h, mock, server := newTestHandler(t)
+	r := httptest.NewRequest("PUT", "/account/language", strings.NewReader(`{"language": "fr"}`))
+	r.Header.Set("Authorization", signIn(t, server, "gone@bookateria.net"))
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE email = \$1`).WithArgs("gone@bookateria.net").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}))
+
+	w := httptest.NewRecorder()
+	h.updateLanguage(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status %d, want %d: %s", w.Code, http.StatusNotFound, w.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	const email = "reader@bookateria.net"
+	hash, err := generatePasswordHash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		signedIn bool
+		password string
+		status   int
+	}{
+		{"deleted", true, "correct horse battery staple", http.StatusOK},
+		{"wrong password", true, "incorrect", http.StatusUnauthorized},
+		{"signed out", false, "correct horse battery staple", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, mock, server := newTestHandler(t)
+			r := httptest.NewRequest("DELETE", "/account", strings.NewReader(`{"password": "`+test.password+`"}`))
+			if test.signedIn {
+				r.Header.Set("Authorization", signIn(t, server, email))
+				mock.ExpectQuery(`SELECT \* FROM "users" WHERE email = \$1 AND "users"."deleted_at" IS NULL`).
+					WithArgs(email).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password"}).AddRow(7, email, hash))
+			}
+			if test.status == http.StatusOK {
+				// Soft deleted: only deleted_at is set, the row stays
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "users" SET "deleted_at"=\$1 WHERE "users"."id" = \$2`).
+					WithArgs(sqlmock.AnyArg(), 7).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`SELECT "id" FROM "users" WHERE email = \$1`).WithArgs(email).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+				mock.ExpectQuery(`INSERT INTO "audit_log"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectCommit()
+			}
+
+			w := httptest.NewRecorder()
+			h.deleteUser(w, r)
+			if w.Code != test.status {
+				t.Errorf("status %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+
+			deleted := test.status == http.StatusOK
+			if test.signedIn && server.Exists(email) == deleted {
+				t.Errorf("session kept: %v, want %v", server.Exists(email), !deleted)
+			}
+			if queued, _ := server.List("email_queue"); (len(queued) == 1) != deleted {
+				t.Errorf("%d emails queued", len(queued))
+			}
+		})
+	}
+}
+
+func TestRestoreUser(t *testing.T) {
+	const email = "reader@bookateria.net"
+
+	tests := []struct {
+		name       string
+		pin        string
+		restorable bool
+		status     int
+	}{
+		{"restored", "123456", true, http.StatusOK},
+		{"wrong pin", "654321", true, http.StatusUnauthorized},
+		{"past the grace period", "123456", false, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, mock, server := newTestHandler(t)
+			if err := server.Set("account_restore_"+email, "123456"); err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest("POST", "/account/restore",
+				strings.NewReader(`{"email": "Reader@bookateria.net", "pin": "`+test.pin+`"}`))
+
+			rows := sqlmock.NewRows([]string{"id", "email", "deleted_at"})
+			if test.restorable {
+				rows.AddRow(7, email, time.Now().Add(-time.Hour))
+			}
+			mock.ExpectQuery(`SELECT \* FROM "users" WHERE email = \$1 AND deleted_at IS NOT NULL AND deleted_at > \$2 AND purged_at IS NULL`).
+				WithArgs(email, sqlmock.AnyArg()).WillReturnRows(rows)
+			if test.status == http.StatusOK {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "users" SET "deleted_at"=\$1,"updated_at"=\$2 WHERE "id" = \$3`).
+					WithArgs(nil, sqlmock.AnyArg(), 7).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`SELECT "id" FROM "users" WHERE email = \$1`).WithArgs(email).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+				mock.ExpectQuery(`INSERT INTO "audit_log"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectCommit()
+			}
+
+			w := httptest.NewRecorder()
+			h.restoreUser(w, r)
+			if w.Code != test.status {
+				t.Errorf("status %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			// The pin works once
+			if used := !server.Exists("account_restore_" + email); used != (test.status == http.StatusOK) {
+				t.Errorf("pin used up: %v", used)
+			}
+		})
+	}
+}
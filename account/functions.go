@@ -1,22 +1,27 @@
 package account
 
 import (
+	"bookateriago/audit"
+	"bookateriago/config"
 	"bookateriago/core"
+	"bookateriago/i18n"
 	"bookateriago/log"
+	"bookateriago/tracing"
+	"context"
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
+	"go.opentelemetry.io/otel/label"
 	"golang.org/x/crypto/argon2"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"math/big"
 	"net"
 	"net/http"
 	"regexp"
 	"sort"
-	"strconv"
 	"strings"
+	"time"
 	"unicode"
 )
 
@@ -25,7 +30,7 @@ import (
 func generateOTP() string {
 	otp, err := rand.Int(rand.Reader, big.NewInt(9999999))
 	if err != nil {
-		fmt.Println(err)
+		log.ErrorHandler(err)
 	}
 
 	return otp.String()
@@ -141,89 +146,122 @@ func passwordValidator(password string) bool {
 	return passLen && isNotCommon && hasNumber && hasLower && hasUpper
 }
 
-/* userDetails
-Checks if string is empty
-return true || false
-*/
-func userDetails(fullName, alias, userName string) bool {
-	if strings.Join(strings.Fields(fullName), " ") == "" ||
-		strings.Join(strings.Fields(alias), " ") == "" ||
-		strings.Join(strings.Fields(userName), " ") == "" {
-		return true
-	}
-	return false
-}
-
 /*  emailValidator : This function does (currently) 2 checks on the email to ensure it is correct
 A regex check and an MX lookup that checks if the domain has MX records
 The regex check is ridiculously simple because.
 1, We are still doing an MX lookup
 2, We would still send a verification email. So why make it complex.
 Returns true if the email is good to go and false otherwise */
-func emailValidator(email string) bool {
+func emailValidator(ctx context.Context, email string) bool {
 	re := regexp.MustCompile("^.+@.+\\..+$")
 	validity := re.MatchString(email)
 	if !validity {
 		return false
 	}
 	parts := strings.Split(email, "@")
-	mx, err := net.LookupMX(parts[1])
-	log.ErrorHandler(err)
+	ctx, span := tracing.Child(ctx, "dns lookup_mx", label.String("net.peer.name", parts[1]))
+	mx, err := net.DefaultResolver.LookupMX(ctx, parts[1])
+	tracing.End(span, err)
+	log.ErrorContext(ctx, err)
 	if err != nil || len(mx) == 0 {
 		return false
 	}
 	return true
 }
 
-// InitDatabase : Initialize the postgres db and migrate the User and Profile models
-func InitDatabase() *gorm.DB {
-	viperConfig := core.ReadViper()
-	var (
-		databaseName = viperConfig.Get("database.name")
-		port         = viperConfig.Get("database.port")
-		pass         = viperConfig.Get("database.pass")
-		user         = viperConfig.Get("database.user")
-		host         = viperConfig.Get("database.host")
-		ssl          = viperConfig.Get("database.ssl")
-	)
+func (h *handler) DuplicateCheck(ctx context.Context, email string) bool {
+	// Check if email already exists in the db.
+	// Should prevent postgres incrementing ID when no new user is created
+	var count int64
 
-	postgresConnection := fmt.Sprintf("host=%s port=%d user=%s dbname=%s password=%s sslmode=%s",
-		host, port, user, databaseName, pass, ssl)
-	db, err := gorm.Open(postgres.Open(postgresConnection), &gorm.Config{})
-	log.ErrorHandler(err)
+	// Soft deleted accounts still hold on to their email until they are purged
+	h.db.WithContext(ctx).Unscoped().Model(&User{}).Where("email = ?", email).Count(&count)
+	return count > 0
+}
 
-	err = db.AutoMigrate(&User{})
-	err = db.AutoMigrate(&profile{})
-	log.ErrorHandler(err)
-	return db
+// IsAdmin checks if the user with the given email is an admin
+func IsAdmin(ctx context.Context, db *gorm.DB, email string) bool {
+	var count int64
+	db.WithContext(ctx).Model(&User{}).Where("email = ? AND is_admin = ?", strings.ToLower(email), true).Count(&count)
+	return count > 0
 }
 
-func Paginate(r *http.Request) func(db *gorm.DB) *gorm.DB {
-	return func(db *gorm.DB) *gorm.DB {
-		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-		if page <= 0 {
-			page = 1
-		}
+// preferredLanguage is the language to email the user in. Falls back to the language of the request
+// for users that haven't picked one, or don't exist.
+func preferredLanguage(user User, r *http.Request) string {
+	if user.Language != "" {
+		return user.Language
+	}
+	return i18n.FromRequest(r)
+}
 
-		pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
-		switch {
-		case pageSize > 50:
-			pageSize = 50
-		default:
-			pageSize = 10
+// deletionGracePeriod is how long a deleted account can still be restored before it is purged.
+// Set with account.deletionGracePeriod, 30 days by default.
+func deletionGracePeriod() time.Duration {
+	return config.Get().Account.DeletionGracePeriod
+}
+
+// restorableUser finds a soft deleted user whose grace period has not run out yet
+func (h *handler) restorableUser(ctx context.Context, email string) (User, bool) {
+	var user User
+	cutOff := time.Now().Add(-deletionGracePeriod())
+	h.db.WithContext(ctx).Unscoped().Where("email = ? AND deleted_at IS NOT NULL AND deleted_at > ? AND purged_at IS NULL",
+		email, cutOff).Find(&user)
+	return user, user.ID != 0
+}
+
+// PurgeDeletedUsers removes the accounts of db whose deletion grace period has expired.
+// Users are hard deleted when nothing else references them, which cascades to their profile and votes.
+// Users that still own content (documents, questions, answers...) are anonymized instead.
+func PurgeDeletedUsers(db *gorm.DB) {
+	var users []User
+	cutOff := time.Now().Add(-deletionGracePeriod())
+	db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at <= ? AND purged_at IS NULL", cutOff).Find(&users)
+
+	for _, user := range users {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Unscoped().Delete(&user).Error; err != nil {
+				return err
+			}
+			// Only that it happened is recorded, keeping the personal data being purged out of the log
+			return audit.Record(tx, nil, audit.Change{Action: audit.Delete, EntityType: "user", EntityID: user.ID})
+		})
+		if err == nil {
+			continue
 		}
 
-		offset := (page - 1) * pageSize
-		return db.Offset(offset).Limit(pageSize)
+		// Still referenced somewhere, so strip every bit of personal data instead
+		now := time.Now()
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Unscoped().Model(&user).Updates(map[string]interface{}{
+				"email":             fmt.Sprintf("deleted-%d@users.bookateria.net", user.ID),
+				"user_name":         "",
+				"full_name":         "Deleted User",
+				"alias":             "",
+				"password":          "",
+				"is_active":         false,
+				"is_email_verified": false,
+				"purged_at":         &now,
+			}).Error
+			if err != nil {
+				return err
+			}
+			return audit.Record(tx, nil, audit.Change{Action: audit.Update, EntityType: "user", EntityID: user.ID})
+		})
+		log.ErrorHandler(err)
 	}
 }
 
-func DuplicateCheck(email string) bool {
-	// Check if email already exists in the db.
-	// Should prevent postgres incrementing ID when no new user is created
-	var count int64
-	var db = InitDatabase()
-
-	db.Model(&User{}).Where("email = ?", email).Count(&count)
-	return count > 0
+// StartPurge runs PurgeDeletedUsers every interval until ctx is cancelled
+func StartPurge(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		PurgeDeletedUsers(db)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
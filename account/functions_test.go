@@ -0,0 +1,40 @@
+package account
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	h, mock, _ := newTestHandler(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE deleted_at IS NOT NULL AND deleted_at <= \$1 AND purged_at IS NULL`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).
+			AddRow(7, "lurker@bookateria.net").
+			AddRow(8, "author@bookateria.net"))
+
+	// Nothing refers to the first one, so it goes for good
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "users" WHERE "users"."id" = \$1`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "audit_log"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	// The second still owns documents, so it is stripped of its personal data instead
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "users" WHERE "users"."id" = \$1`).WithArgs(8).
+		WillReturnError(errors.New("violates foreign key constraint fk_documents_uploader"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET .*"email"=\$\d.*"full_name"=\$\d.*"password"=\$\d.*"purged_at"=\$\d.* WHERE "id" = \$\d+`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "audit_log"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectCommit()
+
+	PurgeDeletedUsers(h.db)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
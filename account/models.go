@@ -1,6 +1,10 @@
 package account
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // User model. Simple enough
 type User struct {
@@ -16,8 +20,14 @@ type User struct {
 	LastLogin       time.Time `json:"last_login"`
 	IsActive        bool      `json:"is_active" gorm:"default:false"`
 	IsEmailVerified bool      `json:"is_email_verified" gorm:"default:false"`
+	Language        string    `json:"language" gorm:"default:en"`
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
+	// DeletedAt is set when the owner deletes the account. Until the grace period runs out
+	// the account is hidden but can still be restored. PurgedAt marks accounts whose
+	// personal data has been anonymized after the grace period.
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	PurgedAt  *time.Time     `json:"-"`
 }
 
 // profile model. Could be extended soon
@@ -1,16 +1,26 @@
 package account
 
-import "github.com/gorilla/mux"
+import (
+	"bookateriago/app"
+
+	"github.com/gorilla/mux"
+)
 
 // Router contains all endpoints for accounts.
-func Router(router *mux.Router) *mux.Router {
-	router.HandleFunc("/all", allUsers).Methods("GET")
-	router.HandleFunc("", postUser).Methods("POST")
-	router.HandleFunc("/{id}", getUser).Methods("GET")
-	router.HandleFunc("/verify-email", verifyEmail).Methods("POST")
-	router.HandleFunc("/request-otp", requestOTP).Methods("POST")
-	router.HandleFunc("/reset-password", resetPassword).Methods("POST")
-	router.HandleFunc("/request-password-reset", resetPasswordRequest).Methods("POST")
+func Router(router *mux.Router, a *app.App) *mux.Router {
+	h := &handler{db: a.DB, redis: a.Redis, sessions: a.Sessions, emails: a.Emails}
+
+	router.HandleFunc("/all", h.allUsers).Methods("GET")
+	router.HandleFunc("", h.postUser).Methods("POST")
+	router.HandleFunc("", h.deleteUser).Methods("DELETE")
+	router.HandleFunc("/language", h.updateLanguage).Methods("PUT")
+	router.HandleFunc("/{id}", h.getUser).Methods("GET")
+	router.HandleFunc("/verify-email", h.verifyEmail).Methods("POST")
+	router.HandleFunc("/request-otp", h.requestOTP).Methods("POST")
+	router.HandleFunc("/reset-password", h.resetPassword).Methods("POST")
+	router.HandleFunc("/request-password-reset", h.resetPasswordRequest).Methods("POST")
+	router.HandleFunc("/request-restore", h.requestRestore).Methods("POST")
+	router.HandleFunc("/restore", h.restoreUser).Methods("POST")
 
 	return router
 }
@@ -0,0 +1,156 @@
+package admin
+
+import (
+	"bookateriago/audit"
+	"bookateriago/cache"
+	"bookateriago/core"
+	emails "bookateriago/email"
+	"bookateriago/health"
+	"bookateriago/log"
+	"bookateriago/pagination"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// handler serves the admin tools: the email queue, the audit log and the server status
+type handler struct {
+	db       *gorm.DB
+	sessions *core.Sessions
+	emails   *emails.Queue
+	health   *health.Checker
+}
+
+// failedEmail is what failedEmails shows of a dead message. The bodies are left out: they hold one time
+// passwords and reset codes.
+type failedEmail struct {
+	ID        string    `json:"id"`
+	To        string    `json:"to"`
+	Template  string    `json:"template"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// failedEmails lists a page of the emails that could not be delivered after every retry
+func (h *handler) failedEmails(w http.ResponseWriter, r *http.Request) {
+	params, invalid := pagination.Parse(r)
+	if len(invalid) > 0 {
+		core.WriteProblem(w, r, core.FourHundred, invalid...)
+		return
+	}
+
+	messages, err := h.emails.DeadMessages(r.Context())
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
+
+	start, end, page := pagination.Slice(params, len(messages))
+	failed := make([]failedEmail, 0, end-start)
+	for _, queued := range messages[start:end] {
+		failed = append(failed, failedEmail{
+			ID:        queued.ID,
+			To:        queued.Message.To,
+			Template:  queued.Message.Template,
+			Attempts:  queued.Attempts,
+			LastError: queued.LastError,
+			FailedAt:  queued.FailedAt,
+		})
+	}
+	page.Result = failed
+	pagination.Write(w, r, page)
+}
+
+// cacheStats reports the response cache hits and misses since the server started
+func cacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(cache.Stats())
+	log.ErrorContext(r.Context(), err)
+}
+
+// status reports the build, uptime and migration version of the server, and the state of its dependencies
+func (h *handler) status(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err := json.NewEncoder(w).Encode(h.health.Report(r.Context()))
+	log.ErrorContext(r.Context(), err)
+}
+
+// requeueEmail gives a failed email a fresh set of attempts
+func (h *handler) requeueEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	params := mux.Vars(r)
+
+	err := h.emails.Requeue(r.Context(), params["id"])
+	respond(w, r, err)
+}
+
+// discardEmail drops a failed email for good
+func (h *handler) discardEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	params := mux.Vars(r)
+
+	err := h.emails.Discard(r.Context(), params["id"])
+	respond(w, r, err)
+}
+
+// respond sends the general response for the outcome of an action on a failed email
+func respond(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(core.Localize(r, core.TwoHundred))
+		log.ErrorContext(r.Context(), err)
+	case errors.Is(err, emails.ErrNotQueued):
+		core.WriteProblem(w, r, core.FourOFour)
+	default:
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+	}
+}
+
+// auditLog lists a page of the audit log, filtered by ?actor= (an email or user ID), ?entity_type=,
+// ?entity_id= and a time range of ?from= and ?to=, in RFC 3339
+func (h *handler) auditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Actor:      query.Get("actor"),
+		EntityType: query.Get("entity_type"),
+	}
+	var invalid []core.FieldError
+
+	if id := query.Get("entity_id"); id != "" {
+		entityID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil || entityID == 0 {
+			invalid = append(invalid, core.Field("entity_id", "invalid"))
+		}
+		filter.EntityID = uint(entityID)
+	}
+	bounds := []struct {
+		name  string
+		value *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}}
+	for _, bound := range bounds {
+		if value := query.Get(bound.name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				invalid = append(invalid, core.Field(bound.name, "invalid"))
+			}
+			*bound.value = parsed
+		}
+	}
+	if len(invalid) > 0 {
+		core.WriteProblem(w, r, core.FourHundred, invalid...)
+		return
+	}
+
+	var entries []audit.Entry
+	pagination.List(w, r, audit.Query(r.Context(), h.db, filter), &entries)
+}
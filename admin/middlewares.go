@@ -0,0 +1,19 @@
+package admin
+
+import (
+	"bookateriago/account"
+	"bookateriago/core"
+	"net/http"
+)
+
+// adminOnly stops anyone who isn't a logged in admin from getting through
+func (h *handler) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, email := h.sessions.GetTokenEmail(r)
+		if email == "" || !account.IsAdmin(r.Context(), h.db, email) {
+			core.WriteProblem(w, r, core.FourOOne)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
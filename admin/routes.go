@@ -0,0 +1,21 @@
+package admin
+
+import (
+	"bookateriago/app"
+
+	"github.com/gorilla/mux"
+)
+
+// Router contains all routes for admin tools. Every route requires an admin user.
+func Router(router *mux.Router, a *app.App) *mux.Router {
+	h := &handler{db: a.DB, sessions: a.Sessions, emails: a.Emails, health: a.Health}
+
+	router.HandleFunc("/emails/failed", h.failedEmails).Methods("GET")
+	router.HandleFunc("/emails/failed/{id}/requeue", h.requeueEmail).Methods("POST")
+	router.HandleFunc("/emails/failed/{id}", h.discardEmail).Methods("DELETE")
+	router.HandleFunc("/cache", cacheStats).Methods("GET")
+	router.HandleFunc("/audit", h.auditLog).Methods("GET")
+	router.HandleFunc("/status", h.status).Methods("GET")
+	router.Use(h.adminOnly)
+	return router
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"bookateriago/cache"
+	"bookateriago/config"
+	"bookateriago/core"
+	emails "bookateriago/email"
+	"bookateriago/health"
+	"bookateriago/metrics"
+	"bookateriago/storage"
+	"bookateriago/tracing"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// App owns everything shared between requests. It is built once at startup and handed to every router,
+// so the whole server works off one database pool and one Redis pool. Routers keep what they need of it
+// with their handlers, nothing is kept in package variables.
+type App struct {
+	Config   *config.Config
+	DB       *gorm.DB
+	Redis    *redis.Client
+	Mailer   emails.Mailer
+	Storage  storage.Storage
+	Sessions *core.Sessions
+	Cache    *cache.Cache
+	Emails   *emails.Queue
+	Uploads  *storage.Uploads
+	Health   *health.Checker
+}
+
+// New connects to Postgres and Redis and builds the mailer and storage backend from the configuration.
+// Connections are checked straight away, so a server that can't reach them never starts.
+func New(settings *config.Config) (*App, error) {
+	db, err := OpenDatabase(settings.Database)
+	if err != nil {
+		return nil, fmt.Errorf("database: %w", err)
+	}
+
+	client := redis.NewClient(settings.Redis.Options())
+	if settings.Metrics.Enabled {
+		if err := db.Use(metrics.Database{}); err != nil {
+			_ = closeDatabase(db)
+			return nil, fmt.Errorf("database: %w", err)
+		}
+		client.AddHook(metrics.Redis{})
+	}
+	if settings.Tracing.Enabled {
+		if err := db.Use(tracing.Database{}); err != nil {
+			_ = closeDatabase(db)
+			return nil, fmt.Errorf("database: %w", err)
+		}
+		client.AddHook(tracing.Redis{})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = closeDatabase(db)
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+
+	store, err := storage.New(settings)
+	if err != nil {
+		_ = closeDatabase(db)
+		_ = client.Close()
+		return nil, fmt.Errorf("storage: %w", err)
+	}
+
+	mailer := emails.New(settings.Email)
+	return &App{
+		Config:   settings,
+		DB:       db,
+		Redis:    client,
+		Mailer:   mailer,
+		Storage:  store,
+		Sessions: core.NewSessions(client),
+		Cache:    cache.New(client, settings.Cache),
+		Emails:   emails.NewQueue(client, mailer),
+		Uploads:  storage.NewUploads(store, client),
+		Health:   health.New(db, client, store, mailer, settings.Server.HealthTimeout),
+	}, nil
+}
+
+// Close releases the database and Redis connections
+func (a *App) Close() error {
+	redisErr := a.Redis.Close()
+	if err := closeDatabase(a.DB); err != nil {
+		return err
+	}
+	return redisErr
+}
+
+// OpenDatabase opens the Postgres pool, sized by the database settings
+func OpenDatabase(settings config.DatabaseConfig) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(settings.DSN()), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(settings.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(settings.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(settings.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(settings.ConnMaxIdleTime)
+	return db, nil
+}
+
+func closeDatabase(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
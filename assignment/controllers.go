@@ -2,135 +2,131 @@ package assignment
 
 import (
 	"bookateriago/account"
+	"bookateriago/audit"
+	"bookateriago/binding"
 	"bookateriago/core"
 	"bookateriago/log"
-	"crypto/rand"
+	"bookateriago/pagination"
+	"bookateriago/slugs"
+	"bookateriago/storage"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
-	"math/big"
+	"mime/multipart"
 	"net/http"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 )
 
-var (
-	oneSubmission submission
-	submissions   []submission
-	oneProblem    problem
-	problems      []problem
-	user          account.User
-	db            = initDatabase()
-)
+// handler serves the assignment routes, which keep the submitted files in storage
+type handler struct {
+	db       *gorm.DB
+	store    storage.Storage
+	uploads  *storage.Uploads
+	sessions *core.Sessions
+}
 
 // questionRequest - Accepted structure for taking data from request body
 type questionRequest struct {
-	Title           string `json:"title"`
-	Description     string `json:"description"`
-	Deadline        string `json:"deadline"`
-	SubmissionCount int    `json:"submission_count"`
+	Title           string `json:"title" validate:"required,max=200"`
+	Description     string `json:"description" validate:"max=10000"`
+	Deadline        string `json:"deadline" validate:"required,rfc3339"`
+	SubmissionCount int    `json:"submission_count" validate:"required,min=1,max=100"`
+}
+
+// questionUpdate - Accepted structure for updating a question. Fields that are left out keep their value.
+type questionUpdate struct {
+	Title           *string `json:"title" validate:"required,max=200"`
+	Description     *string `json:"description" validate:"max=10000"`
+	Deadline        *string `json:"deadline" validate:"required,rfc3339"`
+	SubmissionCount *int    `json:"submission_count" validate:"required,min=1,max=100"`
 }
 
 // postQuestion for creating a new assignment question
-func postQuestion(w http.ResponseWriter, r *http.Request) {
+func (h *handler) postQuestion(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	_, email := core.GetTokenEmail(r)
+	_, email := h.sessions.GetTokenEmail(r)
 
 	if email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
 	var questionR questionRequest
-	db.Find(&user, "email = ?", strings.ToLower(email))
-
-	err := json.NewDecoder(r.Body).Decode(&questionR)
-	log.ErrorHandler(err)
-
-	deadline, _ := time.Parse(time.RFC3339, questionR.Deadline)
-
-	/// get random string
-	slugCode, err := rand.Int(rand.Reader, big.NewInt(999))
-	if err != nil {
-		fmt.Println(err)
+	if !binding.JSON(w, r, &questionR) {
+		return
 	}
+	var user account.User
+	h.db.WithContext(r.Context()).Find(&user, "email = ?", strings.ToLower(email))
 
-	// Remove all symbols and spaces to generate slug.
-	regex, err := regexp.Compile("[^a-zA-Z0-9-]+")
-	log.ErrorHandler(err)
-	questionR.Title = strings.Join(strings.Fields(questionR.Title), "-")
-	processed := regex.ReplaceAllString(questionR.Title, "")
-	log.ErrorHandler(err)
+	deadline, _ := time.Parse(time.RFC3339, questionR.Deadline)
 
-	oneProblem = problem{
-		Title:           questionR.Title,
+	question := problem{
+		Title:           strings.Join(strings.Fields(questionR.Title), " "),
 		Description:     questionR.Description,
 		Deadline:        deadline,
 		User:            user,
-		Slug:            processed + "-" + slugCode.String(),
 		SubmissionCount: questionR.SubmissionCount,
 	}
 
-	db.Create(&oneProblem)
+	// Save the problem under a slug, made from the title, that no other problem has
+	err := slugs.Create(r.Context(), h.db, "problems", question.Title, func(tx *gorm.DB, slug string) error {
+		question.Slug = slug
+		if err := tx.Create(&question).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Create, EntityType: "problem", EntityID: question.ID, After: question,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(oneProblem)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	err = json.NewEncoder(w).Encode(question)
+	log.ErrorContext(r.Context(), err)
 	return
 }
 
 // getQuestion gets a question by the slug passed in, in the url
-func getQuestion(w http.ResponseWriter, r *http.Request) {
+func (h *handler) getQuestion(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	slug, _ := params["slug"]
 
-	if !xExists(slug, "question") {
+	if !h.xExists(r.Context(), slug, "question") {
 		// Checks if assignment problem exists
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
-	db.Preload(clause.Associations).Find(&oneProblem, "slug = ?", slug)
+	var question problem
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Find(&question, "slug = ?", slug)
 	w.WriteHeader(http.StatusOK)
-	err := json.NewEncoder(w).Encode(oneProblem)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	err := json.NewEncoder(w).Encode(question)
+	log.ErrorContext(r.Context(), err)
 	return
 }
 
-// getQuestions gets all assignment questions in the db.
-func getQuestions(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	// Fetch all assignment problems
-	db.Preload(clause.Associations).Find(&problems)
-	w.WriteHeader(http.StatusOK)
-	err := json.NewEncoder(w).Encode(problems)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
-	return
+// getQuestions gets a page of the assignment questions in the db.
+func (h *handler) getQuestions(w http.ResponseWriter, r *http.Request) {
+	var problems []problem
+	pagination.List(w, r, h.db.WithContext(r.Context()).Model(&problem{}).Preload(clause.Associations), &problems)
 }
 
 // updateQuestion adjusts an already existing assignment question
-func updateQuestion(w http.ResponseWriter, r *http.Request) {
+func (h *handler) updateQuestion(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Get the logged in user
-	_, email := core.GetTokenEmail(r)
+	_, email := h.sessions.GetTokenEmail(r)
 	if email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
@@ -139,47 +135,69 @@ func updateQuestion(w http.ResponseWriter, r *http.Request) {
 	slug := params["slug"]
 
 	// Check if problem exists
-	if !xExists(slug, "question") {
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+	if !h.xExists(r.Context(), slug, "question") {
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
-	//db.Find(&problem, "slug = ?", slug)
-	db.Preload(clause.Associations).Where("slug = ?", slug).Find(&oneProblem)
+	var question problem
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Where("slug = ?", slug).Find(&question)
 
 	// Check if user has permission to edit. Meaning, did the logged in use create this?
-	if email != oneProblem.User.Email {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+	if email != question.User.Email {
+		core.WriteProblem(w, r, core.FourOThree)
 		return
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&oneProblem)
-	log.ErrorHandler(err)
-	db.Save(&oneProblem)
+	// Only the question details can change, never who owns it or where it lives
+	var body questionUpdate
+	if !binding.JSON(w, r, &body) {
+		return
+	}
+	before := audit.Snapshot(question)
+	if body.Title != nil {
+		question.Title = strings.Join(strings.Fields(*body.Title), " ")
+	}
+	if body.Description != nil {
+		question.Description = *body.Description
+	}
+	if body.Deadline != nil {
+		question.Deadline, _ = time.Parse(time.RFC3339, *body.Deadline)
+	}
+	if body.SubmissionCount != nil {
+		question.SubmissionCount = *body.SubmissionCount
+	}
 
-	err = json.NewEncoder(w).Encode(oneProblem)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	// A new title gets a new slug, and links to the old one are redirected
+	err := slugs.Update(r.Context(), h.db, "problems", question.ID, question.Slug, question.Title, func(tx *gorm.DB, slug string) error {
+		question.Slug = slug
+		if err := tx.Save(&question).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Update, EntityType: "problem", EntityID: question.ID,
+			Before: before, After: question,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(question)
+	log.ErrorContext(r.Context(), err)
 	return
 }
 
 // deleteQuestion removes a question
-func deleteQuestion(w http.ResponseWriter, r *http.Request) {
+func (h *handler) deleteQuestion(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Check if user is logged in
-	_, email := core.GetTokenEmail(r)
+	_, email := h.sessions.GetTokenEmail(r)
 	if email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
@@ -188,171 +206,345 @@ func deleteQuestion(w http.ResponseWriter, r *http.Request) {
 	slug := params["slug"]
 
 	// Check if problem exists
-	if !xExists(slug, "problem") {
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+	if !h.xExists(r.Context(), slug, "question") {
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
-	//db.Find(&problem, "slug = ?", slug)
-	db.Preload(clause.Associations).Where("slug = ?", slug).Find(&oneProblem)
+	var question problem
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Where("slug = ?", slug).Find(&question)
 	// Check if logged in user is the creator
-	if email != oneProblem.User.Email {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+	if email != question.User.Email {
+		core.WriteProblem(w, r, core.FourOThree)
 		return
 	}
 
-	db.Where("slug = ?", slug).Delete(&oneProblem)
+	err := h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("slug = ?", slug).Delete(&problem{}).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Delete, EntityType: "problem", EntityID: question.ID, Before: question,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
-	log.AccessHandler(r, 204)
 	return
 }
 
 // Endpoints for Submissions
 
 // PostSubmission creates a new submission for the question which is identified by the slug
-func PostSubmission(w http.ResponseWriter, r *http.Request) {
+func (h *handler) PostSubmission(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "multipart/form-data")
 	params := mux.Vars(r)
 	questionSlug := params["qSlug"]
 
-	if !xExists(questionSlug, "question") {
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+	_, email := h.sessions.GetTokenEmail(r)
+	if email == "" {
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
-	db.Preload(clause.Associations).Where("slug = ?", questionSlug).Find(&oneProblem)
-	_, email := core.GetTokenEmail(r)
-	db.Find(&user, "email = ?", strings.ToLower(email))
 
-	err := r.ParseMultipartForm(32 << 20)
+	if !h.xExists(r.Context(), questionSlug, "question") {
+		core.WriteProblem(w, r, core.FourOFour)
+		return
+	}
+	var (
+		question problem
+		student  account.User
+	)
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Where("slug = ?", questionSlug).Find(&question)
+	h.db.WithContext(r.Context()).Find(&student, "email = ?", strings.ToLower(email))
+
+	var form struct {
+		File *multipart.FileHeader `form:"file" validate:"required"`
+	}
+	if !binding.Form(w, r, &form, storage.MaxUploadSize()) {
+		return
+	}
+	header := form.File
+	file, err := header.Open()
 	if err != nil {
-		log.ErrorHandler(err)
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
+	defer file.Close()
+
+	count := h.submissionCount(r.Context(), student.ID, question.ID)
+	if count >= int64(question.SubmissionCount) {
+		core.WriteProblem(w, r, core.FourHundred.WithCode("submission_limit"))
+		return
 	}
 
-	file, header, err := r.FormFile("file")
+	// Stored under the question the same way uploads through a slot are, so files never overwrite each other
+	key, err := storage.NewKey(submissionPrefix(question), header.Filename)
+	if errors.Is(err, storage.ErrUploadInvalid) {
+		core.WriteProblem(w, r, core.FourHundred, core.Field("file", "invalid"))
+		return
+	}
+	if err == nil {
+		err = h.store.Put(r.Context(), key, file, header.Header.Get("Content-Type"))
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		err = json.NewEncoder(w).Encode(core.FourHundred)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 400)
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
 		return
 	}
 
-	var count int64
+	answer := submission{
+		Problem:     question,
+		User:        student,
+		FileSlug:    key,
+		Submissions: count + 1,
+	}
 
-	db.Preload(clause.Associations).Model(&submission{}).Where("user_id = ? and question_id = ?", user.ID, oneProblem.ID).Count(&count)
-	fmt.Println(count)
-	fmt.Println(oneProblem.SubmissionCount)
-	if int(count) >= oneProblem.SubmissionCount {
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(core.FourHundred)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 400)
+	// Named after the question and the student, with a number added by slugs when they submit again
+	err = slugs.Create(r.Context(), h.db, "submissions", question.Slug+" "+student.Alias, func(tx *gorm.DB, slug string) error {
+		answer.Slug = slug
+		if err := tx.Create(&answer).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Create, EntityType: "submission", EntityID: answer.ID, After: answer,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
 		return
 	}
-	fileNameExtension := strings.Split(header.Filename, ".")
+	err = json.NewEncoder(w).Encode(answer)
+	log.ErrorContext(r.Context(), err)
+	return
+}
+
+// getSubmissions returns a page of the submissions to the individual who created the question
+func (h *handler) getSubmissions(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	slug := params["qSlug"]
 
-	filename := fileNameExtension[0] + "_" + strconv.Itoa(int(count+1)) + fileNameExtension[1]
+	_, email := h.sessions.GetTokenEmail(r)
 
-	status, slug, err := core.S3Upload(file, filename)
-	if !status {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.ErrorHandler(err)
-		err = json.NewEncoder(w).Encode(core.FiveHundred)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 500)
+	if !h.xExists(r.Context(), slug, "question") {
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
-	submissionSlug := oneProblem.Slug + "-" + strings.Join(strings.Fields(oneProblem.User.Alias), "-") + "-" + strconv.Itoa(int(count)+1)
+	var question problem
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Where("slug = ?", slug).Find(&question)
+	//db.Preload(clause.Associations).Find(&problem, "where slug = ?", slug)
+	if email != question.User.Email {
+		core.WriteProblem(w, r, core.FourOThree)
+		return
+	}
 
-	oneSubmission = submission{
-		Problem:     oneProblem,
-		User:        user,
-		FileSlug:    slug,
-		Slug:        submissionSlug,
-		Submissions: count + 1,
+	var submissions []submission
+	query := h.db.WithContext(r.Context()).Model(&submission{}).Preload(clause.Associations).Where("problem_id = ?", question.ID)
+	pagination.List(w, r, query, &submissions)
+}
+
+// getSubmission returns the submission of a particular person
+func (h *handler) getSubmission(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	params := mux.Vars(r)
+	questionSlug := params["qSlug"]
+	submissionSlug := params["aSlug"]
+
+	_, email := h.sessions.GetTokenEmail(r)
+
+	var question problem
+	h.db.WithContext(r.Context()).Where("slug = ?", questionSlug).Find(&question)
+	var answer submission
+	if question.ID != 0 {
+		// A submission is only found under the question it answers
+		h.db.WithContext(r.Context()).Preload(clause.Associations).
+			Where("slug = ? AND problem_id = ?", submissionSlug, question.ID).Find(&answer)
+	}
+	if answer.ID == 0 {
+		core.WriteProblem(w, r, core.FourOFour)
+		return
+	}
+
+	if email != answer.User.Email {
+		core.WriteProblem(w, r, core.FourOThree)
+		return
 	}
 
-	db.Create(&oneSubmission)
-	err = json.NewEncoder(w).Encode(oneSubmission)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	err := json.NewEncoder(w).Encode(answer)
+	log.ErrorContext(r.Context(), err)
 	return
 }
 
-// getSubmissions returns all submissions to the individual who created the question
-func getSubmissions(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// downloadSubmission sends the submitter or the creator of the question to a short lived link for the submitted file
+func (h *handler) downloadSubmission(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	questionSlug := params["qSlug"]
+	submissionSlug := params["aSlug"]
+
+	_, email := h.sessions.GetTokenEmail(r)
+	if email == "" {
+		w.Header().Set("Content-Type", "application/json")
+		core.WriteProblem(w, r, core.FourOOne)
+		return
+	}
 
+	var question problem
+	h.db.WithContext(r.Context()).Where("slug = ?", questionSlug).Find(&question)
+	var answer submission
+	if question.ID != 0 {
+		// A submission is only found under the question it answers
+		h.db.WithContext(r.Context()).Preload("User").Preload("Problem.User").
+			Where("slug = ? AND problem_id = ?", submissionSlug, question.ID).Find(&answer)
+	}
+	if answer.ID == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		core.WriteProblem(w, r, core.FourOFour)
+		return
+	}
+
+	// Only the person who submitted and the person who asked the question get to see the file
+	if email != answer.User.Email && email != answer.Problem.User.Email {
+		w.Header().Set("Content-Type", "application/json")
+		core.WriteProblem(w, r, core.FourOThree)
+		return
+	}
+
+	expiry := storage.URLExpiry()
+	url, err := h.store.SignedURL(r.Context(), answer.FileSlug, expiry)
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		w.Header().Set("Content-Type", "application/json")
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
+
+	core.SendDownload(w, r, url, expiry)
+}
+
+// requestSubmissionUpload hands out a slot for uploading a submission straight to storage.
+// The submission itself is created by finalizeSubmission once the file is there.
+func (h *handler) requestSubmissionUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
-	slug := params["qSlug"]
+	questionSlug := params["qSlug"]
 
-	_, email := core.GetTokenEmail(r)
+	_, email := h.sessions.GetTokenEmail(r)
+	if email == "" {
+		core.WriteProblem(w, r, core.FourOOne)
+		return
+	}
 
-	if !xExists(slug, "question") {
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+	if !h.xExists(r.Context(), questionSlug, "question") {
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
-	db.Preload(clause.Associations).Where("slug = ?", slug).Find(&oneProblem)
-	//db.Preload(clause.Associations).Find(&problem, "where slug = ?", slug)
-	if email != oneProblem.User.Email {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+	var (
+		question problem
+		student  account.User
+		request  storage.UploadRequest
+	)
+	h.db.WithContext(r.Context()).Where("slug = ?", questionSlug).Find(&question)
+	h.db.WithContext(r.Context()).Find(&student, "email = ?", strings.ToLower(email))
+
+	// No point uploading if the submission would be refused anyway
+	if h.submissionCount(r.Context(), student.ID, question.ID) >= int64(question.SubmissionCount) {
+		core.WriteProblem(w, r, core.FourHundred.WithCode("submission_limit"))
 		return
 	}
 
-	db.Preload(clause.Associations).Where("problem_id = ?", oneProblem.ID).Find(&submissions)
-	//db.Find(&submissions, "where problem_id = ?", problem.ID)
-	err := json.NewEncoder(w).Encode(submissions)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
-	return
+	if !binding.JSON(w, r, &request) {
+		return
+	}
+
+	slot, err := h.uploads.NewUpload(r.Context(), student.Email, submissionPrefix(question), request)
+	if err != nil {
+		status := storage.UploadErrorStatus(err)
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.StatusResponse(status))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(slot)
+	log.ErrorContext(r.Context(), err)
 }
 
-// getSubmission returns the submission of a particular person
-func getSubmission(w http.ResponseWriter, r *http.Request) {
+// finalizeSubmission creates the submission for a file uploaded through a slot from requestSubmissionUpload.
+// The slot has to be for the same question, and the file has to match the size and checksum given when
+// the slot was requested.
+func (h *handler) finalizeSubmission(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	questionSlug := params["qSlug"]
-	submissionSlug := params["aSlug"]
 
-	_, email := core.GetTokenEmail(r)
+	_, email := h.sessions.GetTokenEmail(r)
+	if email == "" {
+		core.WriteProblem(w, r, core.FourOOne)
+		return
+	}
 
-	if !xExists(questionSlug, "question") {
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+	if !h.xExists(r.Context(), questionSlug, "question") {
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
-	db.Preload(clause.Associations).Where("slug = ?", submissionSlug).Find(&oneSubmission)
+	var (
+		question problem
+		student  account.User
+	)
+	body := struct {
+		UploadID string `json:"upload_id" validate:"required"`
+	}{}
+	if !binding.JSON(w, r, &body) {
+		return
+	}
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Where("slug = ?", questionSlug).Find(&question)
+	h.db.WithContext(r.Context()).Find(&student, "email = ?", strings.ToLower(email))
 
-	if email != oneSubmission.User.Email {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+	// Checked again, other submissions might have come in since the slot was handed out
+	count := h.submissionCount(r.Context(), student.ID, question.ID)
+	if count >= int64(question.SubmissionCount) {
+		core.WriteProblem(w, r, core.FourHundred.WithCode("submission_limit"))
 		return
 	}
 
-	err := json.NewEncoder(w).Encode(oneSubmission)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
-	return
+	upload, err := h.uploads.FinishUpload(r.Context(), student.Email, submissionPrefix(question), body.UploadID)
+	if err != nil {
+		status := storage.UploadErrorStatus(err)
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.StatusResponse(status))
+		return
+	}
+
+	answer := submission{
+		Problem:     question,
+		User:        student,
+		FileSlug:    upload.Key,
+		Submissions: count + 1,
+	}
+
+	err = slugs.Create(r.Context(), h.db, "submissions", question.Slug+" "+student.Alias, func(tx *gorm.DB, slug string) error {
+		answer.Slug = slug
+		if err := tx.Create(&answer).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Create, EntityType: "submission", EntityID: answer.ID, After: answer,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(answer)
+	log.ErrorContext(r.Context(), err)
 }
@@ -0,0 +1,136 @@
+package assignment
+
+import (
+	"bookateriago/core"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const testKey = "secret"
+
+func TestMain(m *testing.M) {
+	os.Setenv("BOOKATERIA_SETTINGS_KEY", testKey)
+	os.Exit(m.Run())
+}
+
+// newTestHandler serves from a mocked database, with sessions kept in an in-memory Redis
+func newTestHandler(t *testing.T) (*handler, sqlmock.Sqlmock, *miniredis.Miniredis) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		sessions.Close()
+	})
+
+	client := redis.NewClient(&redis.Options{Addr: sessions.Addr()})
+	return &handler{db: db, sessions: core.NewSessions(client)}, mock, sessions
+}
+
+// signIn hands out a token for email the way auth does
+func signIn(t *testing.T, sessions *miniredis.Miniredis, email string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"email": email,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(testKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sessions.Set(email, token); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestDeleteQuestion(t *testing.T) {
+	const owner = "owner@bookateria.net"
+
+	tests := []struct {
+		name   string
+		email  string
+		exists bool
+		status int
+	}{
+		{"owner", owner, true, http.StatusNoContent},
+		{"someone else", "student@bookateria.net", true, http.StatusForbidden},
+		{"missing", owner, false, http.StatusNotFound},
+		{"signed out", "", true, http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, mock, sessions := newTestHandler(t)
+			r := httptest.NewRequest("DELETE", "/essay/delete", nil)
+			r = mux.SetURLVars(r, map[string]string{"slug": "essay"})
+			if test.email != "" {
+				r.Header.Set("Authorization", signIn(t, sessions, test.email))
+
+				count := 0
+				if test.exists {
+					count = 1
+				}
+				mock.ExpectQuery(`SELECT count\(.*\) FROM "problems" WHERE slug = \$1`).WithArgs("essay").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+			}
+			if test.email != "" && test.exists {
+				mock.ExpectQuery(`SELECT \* FROM "problems" WHERE slug = \$1`).WithArgs("essay").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title", "slug", "user_id"}).AddRow(3, "Essay", "essay", 7))
+				mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(7, owner))
+			}
+			if test.status == http.StatusNoContent {
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM "problems" WHERE slug = \$1`).WithArgs("essay").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`SELECT "id" FROM "users" WHERE email = \$1`).WithArgs(owner).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+				mock.ExpectQuery(`INSERT INTO "audit_log"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectCommit()
+			}
+
+			w := httptest.NewRecorder()
+			h.deleteQuestion(w, r)
+			if w.Code != test.status {
+				t.Errorf("status %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPostSubmissionSignedOut(t *testing.T) {
+	// No queries are expected, the session is checked before the question is even looked up
+	h, _, _ := newTestHandler(t)
+	r := httptest.NewRequest("POST", "/essay/submit", nil)
+	r = mux.SetURLVars(r, map[string]string{"qSlug": "essay"})
+
+	w := httptest.NewRecorder()
+	h.PostSubmission(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status %d, want %d: %s", w.Code, http.StatusUnauthorized, w.Body)
+	}
+}
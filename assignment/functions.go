@@ -1,49 +1,33 @@
 package assignment
 
 import (
-	"bookateriago/core"
-	"bookateriago/log"
-	"fmt"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
+	"context"
 )
 
-// InitDatabase initializes the models for assignments
-func initDatabase() *gorm.DB {
-	viperConfig := core.ReadViper()
-	var (
-		databaseName = viperConfig.Get("database.name")
-		port         = viperConfig.Get("database.port")
-		pass         = viperConfig.Get("database.pass")
-		user         = viperConfig.Get("database.user")
-		host         = viperConfig.Get("database.host")
-		ssl          = viperConfig.Get("database.ssl")
-	)
-
-	postgresConnection := fmt.Sprintf("host=%s port=%d user=%s dbname=%s password=%s sslmode=%s",
-		host, port, user, databaseName, pass, ssl)
-	db, err := gorm.Open(postgres.Open(postgresConnection), &gorm.Config{})
-	log.ErrorHandler(err)
-
-	err = db.AutoMigrate(&problem{}, &submission{})
-	log.ErrorHandler(err)
-
-	return db
-}
-
 // XExists checks the existence of an object given the slug and the model
-func xExists(slug, model string) bool {
+func (h *handler) xExists(ctx context.Context, slug, model string) bool {
 	var count int64
-	var db = initDatabase()
 
 	switch model {
 	case "question":
-		db.Model(&problem{}).Where("slug = ?", slug).Count(&count)
+		h.db.WithContext(ctx).Model(&problem{}).Where("slug = ?", slug).Count(&count)
 		return count > 0
 	case "submission":
-		db.Model(&submission{}).Where("slug = ?", slug).Count(&count)
+		h.db.WithContext(ctx).Model(&submission{}).Where("slug = ?", slug).Count(&count)
 		return count > 0
 	default:
 		return false
 	}
 }
+
+// submissionCount is how many times the user has submitted for the problem
+func (h *handler) submissionCount(ctx context.Context, userID uint, problemID uint) int64 {
+	var count int64
+	h.db.WithContext(ctx).Model(&submission{}).Where("user_id = ? AND problem_id = ?", userID, problemID).Count(&count)
+	return count
+}
+
+// submissionPrefix is where the files submitted for the problem are kept in storage
+func submissionPrefix(question problem) string {
+	return "submissions/" + question.Slug
+}
@@ -1,17 +1,29 @@
 package assignment
 
-import "github.com/gorilla/mux"
+import (
+	"bookateriago/app"
+	"bookateriago/slugs"
+
+	"github.com/gorilla/mux"
+)
 
 // Router is all assignment portal routes
 // 		return *mux.Router
-func Router(router *mux.Router) *mux.Router {
-	router.HandleFunc("/all", getQuestions).Methods("GET")
-	router.HandleFunc("/add", postQuestion).Methods("POST")
-	router.HandleFunc("/{slug}", getQuestion).Methods("GET")
-	router.HandleFunc("/{slug}", updateQuestion).Methods("PUT")
-	router.HandleFunc("/{slug}/delete", deleteQuestion).Methods("DELETE")
-	router.HandleFunc("/{qSlug}/submit", PostSubmission).Methods("POST")
-	router.HandleFunc("/{qSlug}/submissions", getSubmissions).Methods("GET")
-	router.HandleFunc("/{qSlug}/submission/{aSlug}", getSubmission).Methods("GET")
+func Router(router *mux.Router, a *app.App) *mux.Router {
+	h := &handler{db: a.DB, store: a.Storage, uploads: a.Uploads, sessions: a.Sessions}
+
+	router.Use(slugs.Redirects(a.DB, "problems", "slug"), slugs.Redirects(a.DB, "problems", "qSlug"))
+
+	router.HandleFunc("/all", h.getQuestions).Methods("GET")
+	router.HandleFunc("/add", h.postQuestion).Methods("POST")
+	router.HandleFunc("/{slug}", h.getQuestion).Methods("GET")
+	router.HandleFunc("/{slug}", h.updateQuestion).Methods("PUT")
+	router.HandleFunc("/{slug}/delete", h.deleteQuestion).Methods("DELETE")
+	router.HandleFunc("/{qSlug}/submit", h.PostSubmission).Methods("POST")
+	router.HandleFunc("/{qSlug}/submit/upload", h.requestSubmissionUpload).Methods("POST")
+	router.HandleFunc("/{qSlug}/submit/finalize", h.finalizeSubmission).Methods("POST")
+	router.HandleFunc("/{qSlug}/submissions", h.getSubmissions).Methods("GET")
+	router.HandleFunc("/{qSlug}/submission/{aSlug}", h.getSubmission).Methods("GET")
+	router.HandleFunc("/{qSlug}/submission/{aSlug}/download", h.downloadSubmission).Methods("GET")
 	return router
 }
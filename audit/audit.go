@@ -0,0 +1,268 @@
+// Package audit keeps an append-only log of every create, update and delete of content and accounts:
+// who did it, from where, and which fields changed. The database refuses to change or remove entries, so
+// nothing in them may identify a person once their account is purged: actors are kept by user ID only, and
+// the values of personal fields are redacted.
+package audit
+
+import (
+	"bookateriago/requestid"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Actions recorded in the log
+const (
+	Create = "create"
+	Update = "update"
+	Delete = "delete"
+)
+
+// redacted replaces the values of fields that must not end up in the log, only that they changed is kept
+const redacted = "[redacted]"
+
+// secret fields, by their JSON name: credentials, and the personal data of users, which has to go when
+// their account is purged
+var secret = map[string]bool{
+	"password":  true,
+	"email":     true,
+	"user_name": true,
+	"full_name": true,
+	"alias":     true,
+}
+
+// ignored fields change with every save and would only add noise
+var ignored = map[string]bool{
+	"updated_at": true,
+}
+
+// Entry is one change in the log
+type Entry struct {
+	ID uint `json:"id"`
+	// ActorID is the user who made the change, nil for changes made by the server itself
+	ActorID    *uint     `json:"actor_id"`
+	Action     string    `json:"action"`
+	EntityType string    `json:"entity_type"`
+	EntityID   uint      `json:"entity_id"`
+	Changes    Changes   `json:"changes"`
+	IP         string    `json:"ip"`
+	RequestID  string    `json:"request_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (Entry) TableName() string {
+	return "audit_log"
+}
+
+// Diff is the value of a field before and after a change. Before is nil on creates, After on deletes.
+type Diff struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Changes are the fields a change touched, by their JSON name. They are stored as jsonb.
+type Changes map[string]Diff
+
+// Value stores the changes as JSON
+func (c Changes) Value() (driver.Value, error) {
+	if c == nil {
+		return "{}", nil
+	}
+	encoded, err := json.Marshal(c)
+	return string(encoded), err
+}
+
+// Scan reads the changes back from JSON
+func (c *Changes) Scan(value interface{}) error {
+	switch raw := value.(type) {
+	case []byte:
+		return json.Unmarshal(raw, c)
+	case string:
+		return json.Unmarshal([]byte(raw), c)
+	case nil:
+		*c = nil
+		return nil
+	default:
+		return errors.New("audit: changes are not JSON")
+	}
+}
+
+// Change is a create, update or delete to record. Before and After are the entity as it was and as it is
+// now, nil for a create or delete. They are compared by their JSON, so fields left out of it aren't logged.
+// Take Before with Snapshot, a copy of the entity can still share its slices and nested pointers.
+type Change struct {
+	// Actor is the email of the user who made the change, empty when the server made it.
+	// Only the ID of the user is logged.
+	Actor      string
+	Action     string
+	EntityType string
+	EntityID   uint
+	Before     interface{}
+	After      interface{}
+}
+
+// Snapshot is the JSON of entity as it is now, for the Before of a Change. Changes made to the entity
+// afterwards, or by the save itself, don't show up in it.
+func Snapshot(entity interface{}) interface{} {
+	encoded, err := json.Marshal(entity)
+	if err != nil {
+		// Record runs into the same error and reports it
+		return entity
+	}
+	return json.RawMessage(encoded)
+}
+
+// Record adds change to the log, with the address and ID of the request r it was made in. r is nil for
+// changes the server makes by itself. Pass the transaction of the change as tx, so one isn't saved
+// without the other.
+func Record(tx *gorm.DB, r *http.Request, change Change) error {
+	changes, err := diff(change.Before, change.After)
+	if err != nil {
+		return err
+	}
+
+	entry := Entry{
+		Action:     change.Action,
+		EntityType: change.EntityType,
+		EntityID:   change.EntityID,
+		Changes:    changes,
+	}
+	if change.Actor != "" {
+		var ids []uint
+		// Deleted users still made the changes before their deletion
+		if err := tx.Table("users").Where("email = ?", change.Actor).Limit(1).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			entry.ActorID = &ids[0]
+		}
+	}
+	if r != nil {
+		entry.IP = clientIP(r)
+		entry.RequestID = requestid.FromContext(r.Context())
+	}
+	return tx.Create(&entry).Error
+}
+
+// Filter narrows down Query. Zero fields don't filter.
+type Filter struct {
+	// Actor is the email or ID of a user
+	Actor      string
+	EntityType string
+	EntityID   uint
+	From       time.Time
+	To         time.Time
+}
+
+// Query returns the entries of db matching filter, for the caller to paginate
+func Query(ctx context.Context, db *gorm.DB, filter Filter) *gorm.DB {
+	query := db.WithContext(ctx).Model(&Entry{})
+	if filter.Actor != "" {
+		query = query.Where("actor_id IN (SELECT id FROM users WHERE email = ?) OR CAST(actor_id AS text) = ?",
+			filter.Actor, filter.Actor)
+	}
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != 0 {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	return query
+}
+
+// diff lists the fields whose JSON differs between before and after
+func diff(before, after interface{}) (Changes, error) {
+	old, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	current, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := Changes{}
+	for name, value := range old {
+		if next, ok := current[name]; !ok || !reflect.DeepEqual(value, next) {
+			changes[name] = Diff{Before: value, After: next}
+		}
+	}
+	for name, value := range current {
+		if _, ok := old[name]; !ok {
+			changes[name] = Diff{After: value}
+		}
+	}
+	for name, change := range changes {
+		switch {
+		case ignored[name]:
+			delete(changes, name)
+		case secret[name]:
+			changes[name] = Diff{Before: hide(change.Before), After: hide(change.After)}
+		default:
+			changes[name] = Diff{Before: scrub(change.Before), After: scrub(change.After)}
+		}
+	}
+	return changes, nil
+}
+
+// fields is the JSON object entity encodes to, by field name
+func fields(entity interface{}) (map[string]interface{}, error) {
+	if entity == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	var decoded map[string]interface{}
+	err = json.Unmarshal(encoded, &decoded)
+	return decoded, err
+}
+
+func hide(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return redacted
+}
+
+// scrub hides the secret fields of the objects nested in value, like the user a document belongs to
+func scrub(value interface{}) interface{} {
+	switch nested := value.(type) {
+	case map[string]interface{}:
+		for name, field := range nested {
+			if secret[name] {
+				nested[name] = hide(field)
+			} else {
+				nested[name] = scrub(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range nested {
+			nested[i] = scrub(item)
+		}
+	}
+	return value
+}
+
+// clientIP is the address the request came from, without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
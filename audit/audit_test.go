@@ -0,0 +1,162 @@
+package audit
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testUser struct {
+	ID       uint   `json:"id"`
+	Email    string `json:"email"`
+	Alias    string `json:"alias,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+type testDocument struct {
+	ID        uint      `json:"id"`
+	Title     string    `json:"title"`
+	Pages     int       `json:"pages"`
+	Tags      []string  `json:"tags"`
+	Uploader  testUser  `json:"uploader"`
+	Secret    string    `json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func TestDiff(t *testing.T) {
+	document := testDocument{
+		ID:        1,
+		Title:     "Go",
+		Pages:     300,
+		Tags:      []string{"go"},
+		Uploader:  testUser{ID: 7, Email: "reader@bookateria.net"},
+		UpdatedAt: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	change := func(edit func(*testDocument)) testDocument {
+		changed := document
+		changed.Tags = append([]string(nil), document.Tags...)
+		edit(&changed)
+		return changed
+	}
+	uploader := map[string]interface{}{"id": 7.0, "email": redacted}
+
+	tests := []struct {
+		name   string
+		before interface{}
+		after  interface{}
+		want   Changes
+	}{
+		{"nothing changed", document, document, Changes{}},
+		{"field changed", document, change(func(d *testDocument) { d.Title = "Go, again" }),
+			Changes{"title": {Before: "Go", After: "Go, again"}}},
+		{"slice changed", document, change(func(d *testDocument) { d.Tags = append(d.Tags, "book") }),
+			Changes{"tags": {Before: []interface{}{"go"}, After: []interface{}{"go", "book"}}}},
+		{"updated_at is ignored", document, change(func(d *testDocument) { d.UpdatedAt = time.Now() }), Changes{}},
+		{"fields left out of the JSON are ignored", document, change(func(d *testDocument) { d.Secret = "shh" }),
+			Changes{}},
+		{"create", nil, testUser{ID: 7, Email: "reader@bookateria.net"}, Changes{
+			"id":    {After: 7.0},
+			"email": {After: redacted},
+		}},
+		{"delete", testUser{ID: 7, Email: "reader@bookateria.net"}, nil, Changes{
+			"id":    {Before: 7.0},
+			"email": {Before: redacted},
+		}},
+		{"secret field changed", testUser{ID: 7, Email: "old@bookateria.net"}, testUser{ID: 7, Email: "new@bookateria.net"},
+			Changes{"email": {Before: redacted, After: redacted}}},
+		{"secret field added", testUser{ID: 7}, testUser{ID: 7, Alias: "reader"},
+			Changes{"alias": {After: redacted}}},
+		{"password changed", testUser{ID: 7, Password: "old"}, testUser{ID: 7, Password: "new"},
+			Changes{"password": {Before: redacted, After: redacted}}},
+		{"nested secret fields are scrubbed", nil, document, Changes{
+			"id":       {After: 1.0},
+			"title":    {After: "Go"},
+			"pages":    {After: 300.0},
+			"tags":     {After: []interface{}{"go"}},
+			"uploader": {After: uploader},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := diff(test.before, test.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("diff() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	document := testDocument{ID: 1, Title: "Go", Tags: []string{"go"}}
+	before, copied := Snapshot(document), document
+	// Saving fills in the tags in place, and a copy of the document shares them
+	document.Title = "Rust"
+	document.Tags[0] = "rust"
+
+	changes, err := diff(before, document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Changes{
+		"title": {Before: "Go", After: "Rust"},
+		"tags":  {Before: []interface{}{"go"}, After: []interface{}{"rust"}},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("diff() = %v, want %v", changes, want)
+	}
+	if copied.Tags[0] != "rust" {
+		t.Error("a copy of the document doesn't share its tags anymore, this test proves nothing")
+	}
+}
+
+func TestChangesValue(t *testing.T) {
+	tests := []struct {
+		changes Changes
+		want    string
+	}{
+		{nil, "{}"},
+		{Changes{"title": {Before: "Go", After: "Rust"}}, `{"title":{"before":"Go","after":"Rust"}}`},
+	}
+
+	for _, test := range tests {
+		value, err := test.changes.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != test.want {
+			t.Errorf("Value() = %v, want %s", value, test.want)
+		}
+
+		var scanned Changes
+		if err := scanned.Scan([]byte(test.want)); err != nil {
+			t.Fatal(err)
+		}
+		if len(scanned) != len(test.changes) {
+			t.Errorf("Scan(%s) = %v", test.want, scanned)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		remote string
+		want   string
+	}{
+		{"192.0.2.1:1234", "192.0.2.1"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{"192.0.2.1", "192.0.2.1"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remote
+		if got := clientIP(r); got != test.want {
+			t.Errorf("clientIP(%q) = %q, want %q", test.remote, got, test.want)
+		}
+	}
+}
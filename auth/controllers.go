@@ -2,33 +2,27 @@ package auth
 
 import (
 	"bookateriago/account"
+	"bookateriago/binding"
+	"bookateriago/config"
 	"bookateriago/core"
 	"bookateriago/log"
-	"context"
 	"encoding/json"
-	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 )
 
-var (
-	viperConfig = core.ReadViper()
-	jwtKey      = []byte(fmt.Sprintf("%s", viperConfig.Get("settings.key")))
-	db          = account.InitDatabase()
-	redisDb, _  = strconv.Atoi(fmt.Sprintf("%d", viperConfig.Get("redis.database")))
-	ctx         = context.Background()
-	redisClient = redis.NewClient(&redis.Options{
-		Addr: fmt.Sprintf("%s", viperConfig.Get("redis.address")),
-		// Password: fmt.Sprintf("%s", viperConfig.Get("redis.password")),
-		DB: redisDb,
-	})
-	user account.User
-	cred credentials
-)
+var jwtKey = []byte(config.Get().Settings.Key)
+
+// handler serves the auth routes with the database, and the Redis client tokens are kept in
+type handler struct {
+	db       *gorm.DB
+	redis    *redis.Client
+	sessions *core.Sessions
+}
 
 // tokenResponse is the structure of the access token
 type tokenResponse struct {
@@ -39,45 +33,40 @@ type tokenResponse struct {
 
 // credentials is the expected struct for the sign in endpoint
 type credentials struct {
-	Password string `json:"password"`
-	Email    string `json:"email"`
+	Password string `json:"password" validate:"required"`
+	Email    string `json:"email" validate:"required,email"`
 	StayIn   bool   `json:"stay_in"`
 }
 
 // tokenClaims for building jwt token
 type tokenClaims struct {
-	Email string `json:"email"`
+	Email  string `json:"email"`
+	UserID uint   `json:"user_id"`
 	jwt.StandardClaims
 }
 
 // SignIn takes a post request with the credentials to be logged in with
-func signIn(w http.ResponseWriter, r *http.Request) {
+func (h *handler) signIn(w http.ResponseWriter, r *http.Request) {
 	// Reads the body for email and password, gets the user and the password from DB
 	// Compares the password, if correct, returns the token
-	err := json.NewDecoder(r.Body).Decode(&cred)
-
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 400)
+	// Soft deleted users are skipped by the query, so they can't sign in
+	var (
+		user account.User
+		cred credentials
+	)
+	if !binding.JSON(w, r, &cred) {
 		return
 	}
-	db.Find(&user, "email = ?", strings.ToLower(cred.Email))
+	h.db.WithContext(r.Context()).Find(&user, "email = ?", strings.ToLower(cred.Email))
 	if user.Password == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err = json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 	expectedPassword := user.Password
 	correct, _ := account.ComparePassword(cred.Password, expectedPassword)
 
 	if !correct {
-		w.WriteHeader(http.StatusUnauthorized)
-		err = json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
@@ -91,7 +80,8 @@ func signIn(w http.ResponseWriter, r *http.Request) {
 	}
 
 	claims := tokenClaims{
-		Email: cred.Email,
+		Email:  cred.Email,
+		UserID: user.ID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTime.Unix(),
 		},
@@ -100,13 +90,12 @@ func signIn(w http.ResponseWriter, r *http.Request) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, errToken := token.SignedString(jwtKey)
 	if errToken != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 500)
+		log.ErrorContext(r.Context(), errToken)
+		core.WriteProblem(w, r, core.FiveHundred)
 		return
 	}
-	err = redisClient.Set(ctx, user.Email, tokenString, redisTime).Err()
-	log.ErrorHandler(err)
+	err := h.redis.Set(r.Context(), user.Email, tokenString, redisTime).Err()
+	log.ErrorContext(r.Context(), err)
 
 	err = json.NewEncoder(w).Encode(tokenResponse{
 		Name:   "Authorization",
@@ -114,8 +103,7 @@ func signIn(w http.ResponseWriter, r *http.Request) {
 		Expiry: expirationTime,
 	})
 
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	log.ErrorContext(r.Context(), err)
 	return
 }
 
@@ -169,23 +157,19 @@ func signIn(w http.ResponseWriter, r *http.Request) {
 // }
 
 // Logout immediately deletes a valid
-func logout(w http.ResponseWriter, r *http.Request) {
+func (h *handler) logout(w http.ResponseWriter, r *http.Request) {
 	// This function deletes the token from redis, rendering it invalid
 	// Make sure to delete the token on the frontend too
 
 	w.Header().Set("Content-Type", "application/json")
-	_, email := core.GetTokenEmail(r)
+	_, email := h.sessions.GetTokenEmail(r)
 	if email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
-	redisClient.Del(ctx, email)
-	err := json.NewEncoder(w).Encode(core.TwoHundred)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	h.redis.Del(r.Context(), email)
+	err := json.NewEncoder(w).Encode(core.Localize(r, core.TwoHundred))
+	log.ErrorContext(r.Context(), err)
 	return
 }
@@ -1,12 +1,18 @@
 package auth
 
-import "github.com/gorilla/mux"
+import (
+	"bookateriago/app"
+
+	"github.com/gorilla/mux"
+)
 
 // Router contains all routes for authorization
-func Router(router *mux.Router) *mux.Router {
+func Router(router *mux.Router, a *app.App) *mux.Router {
+	h := &handler{db: a.DB, redis: a.Redis, sessions: a.Sessions}
+
 	// router.HandleFunc("/refresh", RefreshToken).Methods("GET")
-	router.HandleFunc("/logout", logout).Methods("POST")
+	router.HandleFunc("/logout", h.logout).Methods("POST")
 	//router.Use(AuthorizationMiddleware)
-	router.HandleFunc("/login", signIn).Methods("POST")
+	router.HandleFunc("/login", h.signIn).Methods("POST")
 	return router
 }
@@ -0,0 +1,198 @@
+package binding
+
+import (
+	"bookateriago/config"
+	"bookateriago/core"
+	"bookateriago/log"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// formMemory is how much of a multipart form is kept in memory, the rest goes to temporary files
+const formMemory = 32 << 20
+
+var (
+	errTooLarge    = errors.New("binding: request body too large")
+	fileHeaderType = reflect.TypeOf(&multipart.FileHeader{})
+)
+
+// JSON decodes the JSON body of the request into dst, a pointer to the request struct of the endpoint, and
+// checks its validate rules. Fields dst doesn't have are refused, and so are bodies over settings.maxBodySize.
+// If anything is wrong the problem is sent and false is returned, so the handler only has to return.
+func JSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	limit := config.Get().Settings.MaxBodySize
+	if r.ContentLength > limit {
+		return tooLarge(w, r)
+	}
+	body := &limitedBody{ReadCloser: r.Body, remaining: limit}
+	r.Body = body
+
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(dst)
+	if err == nil && decoder.More() {
+		// Only one JSON value per body
+		err = errors.New("binding: trailing data after the JSON body")
+	}
+	if body.exceeded {
+		return tooLarge(w, r)
+	}
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FourHundred, decodeErrors(err)...)
+		return false
+	}
+	return valid(w, r, dst)
+}
+
+// Form is JSON for multipart and url encoded forms. Fields of dst are filled from the form values named by
+// their form tag; string, integer, bool and *multipart.FileHeader fields are supported. The body may be
+// maxFileSize bigger than settings.maxBodySize to make room for the files.
+func Form(w http.ResponseWriter, r *http.Request, dst interface{}, maxFileSize int64) bool {
+	limit := config.Get().Settings.MaxBodySize + maxFileSize
+	if r.ContentLength > limit {
+		return tooLarge(w, r)
+	}
+	body := &limitedBody{ReadCloser: r.Body, remaining: limit}
+	r.Body = body
+
+	err := r.ParseMultipartForm(formMemory)
+	if body.exceeded {
+		return tooLarge(w, r)
+	}
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FourHundred)
+		return false
+	}
+
+	if invalid := fill(reflect.ValueOf(dst).Elem(), r); len(invalid) > 0 {
+		core.WriteProblem(w, r, core.FourHundred, invalid...)
+		return false
+	}
+	return valid(w, r, dst)
+}
+
+// valid sends the rules dst breaks, if any
+func valid(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if invalid := Validate(dst); len(invalid) > 0 {
+		core.WriteProblem(w, r, core.FourTwoTwo, invalid...)
+		return false
+	}
+	return true
+}
+
+func tooLarge(w http.ResponseWriter, r *http.Request) bool {
+	core.WriteProblem(w, r, core.FourThirteen)
+	return false
+}
+
+// decodeErrors turns what went wrong decoding a JSON body into field errors, where the field is known
+func decodeErrors(err error) []core.FieldError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return []core.FieldError{core.Field(typeErr.Field, "invalid")}
+	}
+	// encoding/json has no error type for these, just the message
+	if field := strings.TrimPrefix(err.Error(), "json: unknown field "); field != err.Error() {
+		return []core.FieldError{core.Field(strings.Trim(field, `"`), "unknown")}
+	}
+	return nil
+}
+
+// fill sets the fields of dst from the parsed form. Values that don't fit their field and values
+// dst has no field for are returned as field errors.
+func fill(dst reflect.Value, r *http.Request) []core.FieldError {
+	var invalid []core.FieldError
+	known := map[string]bool{}
+
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Type().Field(i)
+		name := field.Tag.Get("form")
+		if name == "" || name == "-" || field.PkgPath != "" {
+			continue
+		}
+		known[name] = true
+		value := dst.Field(i)
+
+		if field.Type == fileHeaderType {
+			if r.MultipartForm != nil && len(r.MultipartForm.File[name]) > 0 {
+				value.Set(reflect.ValueOf(r.MultipartForm.File[name][0]))
+			}
+			continue
+		}
+
+		raw := strings.TrimSpace(r.PostFormValue(name))
+		if raw == "" {
+			continue
+		}
+		var err error
+		switch value.Kind() {
+		case reflect.String:
+			value.SetString(raw)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			var number int64
+			number, err = strconv.ParseInt(raw, 10, value.Type().Bits())
+			value.SetInt(number)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			var number uint64
+			number, err = strconv.ParseUint(raw, 10, value.Type().Bits())
+			value.SetUint(number)
+		case reflect.Bool:
+			var flag bool
+			flag, err = strconv.ParseBool(raw)
+			value.SetBool(flag)
+		default:
+			panic("binding: unsupported form field type " + field.Type.String())
+		}
+		if err != nil {
+			invalid = append(invalid, core.Field(name, "invalid"))
+		}
+	}
+
+	for name := range r.PostForm {
+		if !known[name] {
+			invalid = append(invalid, core.Field(name, "unknown"))
+		}
+	}
+	if r.MultipartForm != nil {
+		for name := range r.MultipartForm.File {
+			if !known[name] {
+				invalid = append(invalid, core.Field(name, "unknown"))
+			}
+		}
+	}
+	return invalid
+}
+
+// limitedBody stops reading a request body once it goes over the limit
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, errTooLarge
+	}
+	// One byte past the limit is enough to tell the body is too large
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = 0
+		b.exceeded = true
+		return n, errTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
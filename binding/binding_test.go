@@ -0,0 +1,153 @@
+package binding
+
+import (
+	"bookateriago/config"
+	"bookateriago/core"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type tagRequest struct {
+	Name string `json:"name" validate:"required,max=5"`
+}
+
+type testRequest struct {
+	Title    string       `json:"title" validate:"required,min=3,max=10"`
+	Count    int          `json:"count" validate:"min=1,max=5"`
+	Kind     string       `json:"kind" validate:"oneof=book paper"`
+	Deadline string       `json:"deadline" validate:"rfc3339"`
+	Link     string       `json:"link" validate:"url"`
+	Email    string       `json:"email" validate:"email"`
+	Summary  *string      `json:"summary" validate:"required"`
+	Tags     []tagRequest `json:"tags" validate:"max=2"`
+}
+
+func bind(body string, chunked bool) (*httptest.ResponseRecorder, bool) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	if chunked {
+		// The size is only found out while reading
+		r.ContentLength = -1
+	}
+	w := httptest.NewRecorder()
+	var request testRequest
+	return w, JSON(w, r, &request)
+}
+
+func problem(t *testing.T, w *httptest.ResponseRecorder) core.Problem {
+	t.Helper()
+	var p core.Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("decoding the problem: %v", err)
+	}
+	return p
+}
+
+func TestJSON(t *testing.T) {
+	limit := config.Get().Settings.MaxBodySize
+	tooLarge := `{"title":"` + strings.Repeat("a", int(limit)) + `"}`
+	tests := []struct {
+		name    string
+		body    string
+		chunked bool
+		status  int
+		errors  []core.FieldError
+	}{
+		{"valid", `{"title":"Go book"}`, false, http.StatusOK, nil},
+		{"unknown field", `{"title":"Go book","extra":1}`, false, http.StatusBadRequest,
+			[]core.FieldError{core.Field("extra", "unknown")}},
+		{"wrong type", `{"title":"Go book","count":"two"}`, false, http.StatusBadRequest,
+			[]core.FieldError{core.Field("count", "invalid")}},
+		{"trailing data", `{"title":"Go book"}{"title":"again"}`, false, http.StatusBadRequest, nil},
+		{"too large", tooLarge, false, http.StatusRequestEntityTooLarge, nil},
+		{"too large without a length", tooLarge, true, http.StatusRequestEntityTooLarge, nil},
+		{"broken rule", `{"title":"Go"}`, false, http.StatusUnprocessableEntity,
+			[]core.FieldError{core.Field("title", "too_short")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w, ok := bind(test.body, test.chunked)
+			if ok != (test.status == http.StatusOK) {
+				t.Fatalf("JSON returned %v with status %d", ok, w.Code)
+			}
+			if ok {
+				return
+			}
+			if w.Code != test.status {
+				t.Fatalf("status %d, want %d", w.Code, test.status)
+			}
+			if errors := codes(problem(t, w).Errors); !reflect.DeepEqual(errors, codes(test.errors)) {
+				t.Errorf("errors %v, want %v", errors, codes(test.errors))
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	summary, blank := "A summary", " "
+	valid := func() testRequest {
+		return testRequest{
+			Title:    "Go book",
+			Count:    2,
+			Kind:     "book",
+			Deadline: "2021-03-01T17:00:00Z",
+			Link:     "https://bookateria.net",
+			Email:    "reader@bookateria.net",
+			Summary:  &summary,
+			Tags:     []tagRequest{{Name: "go"}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(*testRequest)
+		errors []core.FieldError
+	}{
+		{"valid", func(*testRequest) {}, nil},
+		{"required", func(r *testRequest) { r.Title = "  " }, []core.FieldError{core.Field("title", "required")}},
+		{"required pointer left out", func(r *testRequest) { r.Summary = nil }, nil},
+		{"required pointer blanked", func(r *testRequest) { r.Summary = &blank },
+			[]core.FieldError{core.Field("summary", "required")}},
+		{"min string", func(r *testRequest) { r.Title = "Go" }, []core.FieldError{core.Field("title", "too_short")}},
+		{"max string", func(r *testRequest) { r.Title = "A very long title" },
+			[]core.FieldError{core.Field("title", "too_long")}},
+		{"min number", func(r *testRequest) { r.Count = -1 }, []core.FieldError{core.Field("count", "too_small")}},
+		{"max number", func(r *testRequest) { r.Count = 6 }, []core.FieldError{core.Field("count", "too_large")}},
+		{"max slice", func(r *testRequest) { r.Tags = make([]tagRequest, 3) },
+			[]core.FieldError{core.Field("tags", "too_long")}},
+		{"oneof", func(r *testRequest) { r.Kind = "movie" }, []core.FieldError{core.Field("kind", "unsupported")}},
+		{"rfc3339", func(r *testRequest) { r.Deadline = "1 March 2021" },
+			[]core.FieldError{core.Field("deadline", "invalid")}},
+		{"url", func(r *testRequest) { r.Link = "ftp://bookateria.net" }, []core.FieldError{core.Field("link", "invalid")}},
+		{"url without host", func(r *testRequest) { r.Link = "https://" }, []core.FieldError{core.Field("link", "invalid")}},
+		{"email", func(r *testRequest) { r.Email = "reader@bookateria" }, []core.FieldError{core.Field("email", "invalid")}},
+		{"empty values skip rules", func(r *testRequest) {
+			r.Count, r.Kind, r.Deadline, r.Link, r.Email = 0, "", "", "", ""
+		}, nil},
+		{"nested", func(r *testRequest) { r.Tags = []tagRequest{{Name: "go"}, {Name: "golang"}} },
+			[]core.FieldError{core.Field("tags[1].name", "too_long")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := valid()
+			test.change(&request)
+			if errors := Validate(&request); !reflect.DeepEqual(errors, test.errors) {
+				t.Errorf("Validate() = %v, want %v", errors, test.errors)
+			}
+		})
+	}
+}
+
+// codes leaves the localized messages out of field errors, to compare them
+func codes(errors []core.FieldError) []core.FieldError {
+	var stripped []core.FieldError
+	for _, field := range errors {
+		stripped = append(stripped, core.Field(field.Field, field.Code))
+	}
+	return stripped
+}
@@ -0,0 +1,203 @@
+package binding
+
+import (
+	"bookateriago/core"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// emailRegex is a format check only. Whether the address works is for the verification email to find out.
+var emailRegex = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Validate checks the validate tags of the struct v points to and lists the fields that break them.
+// The rules, separated by commas, are:
+//
+//	required     the value isn't empty, blank strings count as empty
+//	min=N max=N  the length of a string (in characters) or slice, or the value of a number
+//	oneof=a b c  the value is one of the listed words
+//	rfc3339      the value is an RFC 3339 time, e.g. 2021-03-01T17:00:00Z
+//	url          the value is an absolute http or https URL
+//	email        the value looks like an email address
+//
+// Only required looks at empty values, the rest are skipped for them. A nil pointer is a field that wasn't
+// sent and passes every rule, otherwise the rules apply to what it points to. That makes pointers handy for
+// partial updates: required on *string means the field can be left out but not blanked. Uploaded files,
+// *multipart.FileHeader, are the exception and are empty when nil. Structs and slices of structs are
+// checked field by field, and their errors are named like tags[0].name.
+func Validate(v interface{}) []core.FieldError {
+	return validateStruct(reflect.ValueOf(v), "")
+}
+
+func validateStruct(value reflect.Value, prefix string) []core.FieldError {
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	var invalid []core.FieldError
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := fieldName(field)
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		name = prefix + name
+
+		if code := check(value.Field(i), field.Tag.Get("validate")); code != "" {
+			invalid = append(invalid, core.Field(name, code))
+			continue
+		}
+
+		nested := value.Field(i)
+		for nested.Kind() == reflect.Ptr && !nested.IsNil() {
+			nested = nested.Elem()
+		}
+		switch {
+		case nested.Kind() == reflect.Struct && nested.Type() != timeType && nested.Type() != fileHeaderType.Elem():
+			invalid = append(invalid, validateStruct(nested, name+".")...)
+		case nested.Kind() == reflect.Slice:
+			for j := 0; j < nested.Len(); j++ {
+				if element := reflect.Indirect(nested.Index(j)); element.Kind() == reflect.Struct {
+					invalid = append(invalid, validateStruct(element, fmt.Sprintf("%s[%d].", name, j))...)
+				}
+			}
+		}
+	}
+	return invalid
+}
+
+// fieldName is the name the client knows the field by: its json tag, else its form tag
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		if name := strings.Split(field.Tag.Get(tag), ",")[0]; name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// check returns the code of the first rule value breaks, or "" if it keeps them all
+func check(value reflect.Value, rules string) string {
+	if rules == "" {
+		return ""
+	}
+	for value.Kind() == reflect.Ptr && value.Type() != fileHeaderType {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+
+	if isEmpty(value) {
+		for _, rule := range strings.Split(rules, ",") {
+			if rule == "required" {
+				return "required"
+			}
+		}
+		return ""
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		name, argument := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, argument = rule[:i], rule[i+1:]
+		}
+
+		switch name {
+		case "required":
+		case "min", "max":
+			limit, err := strconv.ParseFloat(argument, 64)
+			if err != nil {
+				panic("binding: bad " + name + " rule " + strconv.Quote(rule))
+			}
+			if code := compare(value, name, limit); code != "" {
+				return code
+			}
+		case "oneof":
+			if !contains(strings.Fields(argument), fmt.Sprint(value.Interface())) {
+				return "unsupported"
+			}
+		case "rfc3339":
+			if _, err := time.Parse(time.RFC3339, value.String()); err != nil {
+				return "invalid"
+			}
+		case "url":
+			link, err := url.Parse(value.String())
+			if err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" {
+				return "invalid"
+			}
+		case "email":
+			if !emailRegex.MatchString(value.String()) {
+				return "invalid"
+			}
+		default:
+			panic("binding: unknown rule " + strconv.Quote(rule))
+		}
+	}
+	return ""
+}
+
+// compare checks a min or max rule. Strings and slices are too short or too long, numbers too small or too large.
+func compare(value reflect.Value, rule string, limit float64) string {
+	var size float64
+	tooSmall, tooLarge := "too_small", "too_large"
+	switch value.Kind() {
+	case reflect.String:
+		size = float64(utf8.RuneCountInString(strings.TrimSpace(value.String())))
+		tooSmall, tooLarge = "too_short", "too_long"
+	case reflect.Slice, reflect.Map:
+		size = float64(value.Len())
+		tooSmall, tooLarge = "too_short", "too_long"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = value.Float()
+	default:
+		panic("binding: " + rule + " rule on a " + value.Type().String())
+	}
+
+	if rule == "min" && size < limit {
+		return tooSmall
+	}
+	if rule == "max" && size > limit {
+		return tooLarge
+	}
+	return ""
+}
+
+// isEmpty tells if a value counts as not given. Numbers are empty at zero and strings when blank.
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	case reflect.Struct:
+		return false
+	default:
+		return value.IsZero()
+	}
+}
+
+func contains(options []string, value string) bool {
+	for _, option := range options {
+		if option == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"bookateriago/config"
+	"bookateriago/log"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Header tells clients whether a response came from the cache, HIT, or was built for them, MISS
+const Header = "X-Cache"
+
+var (
+	hits   uint64
+	misses uint64
+)
+
+// Cache keeps responses in Redis. A nil Cache caches nothing.
+type Cache struct {
+	client   *redis.Client
+	settings config.CacheConfig
+}
+
+// Counters are the cache hits and misses since the server started
+type Counters struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// entry is a cached response
+type entry struct {
+	ContentType string `json:"content_type"`
+	Link        string `json:"link,omitempty"`
+	Body        []byte `json:"body"`
+}
+
+// New caches responses in client, following settings
+func New(client *redis.Client, settings config.CacheConfig) *Cache {
+	return &Cache{client: client, settings: settings}
+}
+
+// Stats returns the hit and miss counters
+func Stats() Counters {
+	return Counters{Hits: atomic.LoadUint64(&hits), Misses: atomic.LoadUint64(&misses)}
+}
+
+// Cached serves GET requests from the cache, read through to next on a miss. Only 200 responses are kept,
+// for the configured TTL or until one of the tags is purged. The cache is skipped when Redis fails.
+func (c *Cache) Cached(next http.HandlerFunc, tags ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c == nil || !c.settings.Enabled || r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+
+		key, err := c.key(r.Context(), r, tags)
+		if err != nil {
+			log.ErrorContext(r.Context(), err)
+			next(w, r)
+			return
+		}
+
+		if cached, err := c.client.Get(r.Context(), key).Bytes(); err == nil {
+			var hit entry
+			if err := json.Unmarshal(cached, &hit); err == nil {
+				atomic.AddUint64(&hits, 1)
+				w.Header().Set("Content-Type", hit.ContentType)
+				if hit.Link != "" {
+					w.Header().Set("Link", hit.Link)
+				}
+				w.Header().Set(Header, "HIT")
+				_, err = w.Write(hit.Body)
+				log.ErrorContext(r.Context(), err)
+				return
+			}
+		} else if err != redis.Nil {
+			log.ErrorContext(r.Context(), err)
+		}
+
+		atomic.AddUint64(&misses, 1)
+		w.Header().Set(Header, "MISS")
+		recorder := &recorder{ResponseWriter: w, status: http.StatusOK, body: &bytes.Buffer{}}
+		next(recorder, r)
+		if recorder.status != http.StatusOK {
+			return
+		}
+
+		miss, err := json.Marshal(entry{
+			ContentType: w.Header().Get("Content-Type"),
+			Link:        w.Header().Get("Link"),
+			Body:        recorder.body.Bytes(),
+		})
+		if err == nil {
+			err = c.client.Set(r.Context(), key, miss, c.settings.TTL).Err()
+		}
+		log.ErrorContext(r.Context(), err)
+	}
+}
+
+// Invalidates purges the tags once next has handled the request without an error
+func (c *Cache) Invalidates(next http.HandlerFunc, tags ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+		if recorder.status < 400 {
+			log.ErrorContext(r.Context(), c.Purge(r.Context(), tags...))
+		}
+	}
+}
+
+// Purge drops every response cached under any of the tags. Each tag has a version that is part of the keys
+// cached under it, so bumping it leaves the old responses unreachable until they expire. A response that was
+// being built while the tag was purged is stored under the old version and never served.
+func (c *Cache) Purge(ctx context.Context, tags ...string) error {
+	if c == nil || len(tags) == 0 {
+		return nil
+	}
+	pipe := c.client.Pipeline()
+	for _, tag := range tags {
+		pipe.Incr(ctx, "cache:tag:"+tag)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// key is the cache key of the request: the current version of its tags, the path and the query.
+// The query is normalized by sorting its parameters, so ?b=1&a=2 and ?a=2&b=1 share a key.
+func (c *Cache) key(ctx context.Context, r *http.Request, tags []string) (string, error) {
+	versions := make([]string, len(tags))
+	if len(tags) > 0 {
+		names := make([]string, len(tags))
+		for i, tag := range tags {
+			names[i] = "cache:tag:" + tag
+		}
+		values, err := c.client.MGet(ctx, names...).Result()
+		if err != nil {
+			return "", err
+		}
+		for i, value := range values {
+			versions[i] = "0"
+			if version, ok := value.(string); ok {
+				versions[i] = version
+			}
+			versions[i] = tags[i] + "." + versions[i]
+		}
+	}
+	return "cache:response:" + strings.Join(versions, ",") + ":" + r.URL.Path + "?" + r.URL.Query().Encode(), nil
+}
+
+// recorder keeps the status of a response and, when body is set, a copy of what was written
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   *bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(data []byte) (int, error) {
+	if r.body != nil {
+		r.body.Write(data)
+	}
+	return r.ResponseWriter.Write(data)
+}
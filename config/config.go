@@ -0,0 +1,579 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+)
+
+// Config is every setting of the application. It is read from config.yaml, or the file named by
+// BOOKATERIA_CONFIG, and every key can be overridden by an environment variable named after it:
+// database.host is BOOKATERIA_DATABASE_HOST, email.smtp.port is BOOKATERIA_EMAIL_SMTP_PORT and so on.
+type Config struct {
+	Settings SettingsConfig
+	Server   ServerConfig
+	CORS     CORSConfig
+	Database DatabaseConfig
+	Redis    RedisConfig
+	Cache    CacheConfig
+	AWS      AWSConfig
+	Storage  StorageConfig
+	Email    EmailConfig
+	Account  AccountConfig
+	Log      LogConfig
+	Metrics  MetricsConfig
+	Tracing  TracingConfig
+}
+
+// SettingsConfig holds general settings
+type SettingsConfig struct {
+	// Key signs the JWT tokens and the local storage links
+	Key string
+	// MaxBodySize is the largest request body accepted, in bytes. Uploads may add the storage maxUploadSize on top.
+	MaxBodySize int64
+}
+
+// ServerConfig is the HTTP server
+type ServerConfig struct {
+	// Address is the host:port the server listens on
+	Address string
+	// ReadTimeout and WriteTimeout bound reading a whole request and writing its response, uploads and
+	// downloads included. ReadHeaderTimeout bounds the headers alone, IdleTimeout idle keep-alive connections.
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout is how long requests in flight get to finish on SIGTERM before their connections are cut
+	ShutdownTimeout time.Duration
+	// HealthTimeout bounds each dependency check of /readyz and the admin status
+	HealthTimeout time.Duration
+	TLS           TLSConfig
+}
+
+// TLSConfig is where the server gets its certificate
+type TLSConfig struct {
+	// Mode is off, files (CertFile and KeyFile), acme or self-signed
+	Mode     string
+	CertFile string
+	KeyFile  string
+	// Domains are the host names certificates are requested or generated for
+	Domains []string
+	// Email is given to the ACME server for expiry notices
+	Email string
+	// Directory is the ACME directory URL, Let's Encrypt when empty. A local server like Pebble works for testing.
+	Directory string
+	// CacheDir keeps the ACME account and certificates across restarts
+	CacheDir string
+	// RedirectAddress answers ACME HTTP challenges and redirects plain HTTP to HTTPS, empty to turn it off
+	RedirectAddress string
+}
+
+// CORSConfig is which web origins may call the API from a browser, and what with
+type CORSConfig struct {
+	// AllowedOrigins are origins like https://bookateria.net. A * stands for any subdomain or port, as in
+	// https://*.bookateria.net or http://localhost:*, and * alone for every origin.
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders are the request headers browsers may send, * allows any
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and HTTP authentication along
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+	// Overrides replace the policy for the paths starting with their PathPrefix, the longest prefix wins
+	Overrides []CORSOverride
+}
+
+// CORSOverride is the policy of some paths. What it leaves out is taken from the main policy.
+type CORSOverride struct {
+	PathPrefix       string
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials *bool
+	MaxAge           time.Duration
+}
+
+// DatabaseConfig is the Postgres connection
+type DatabaseConfig struct {
+	Host string
+	Port int
+	Name string
+	User string
+	Pass string
+	SSL  string
+	// Connection pool, shared by every request
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// AutoMigrate applies pending migrations when the server starts
+	AutoMigrate bool
+}
+
+// DSN is the connection string for the gorm postgres driver
+func (d DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s port=%d user=%s dbname=%s password=%s sslmode=%s",
+		d.Host, d.Port, d.User, d.Name, d.Pass, d.SSL)
+}
+
+// RedisConfig is the Redis connection
+type RedisConfig struct {
+	Address  string
+	Password string
+	Database int
+	// PoolSize is the most connections open at once, 0 lets go-redis pick 10 per CPU
+	PoolSize     int
+	MinIdleConns int
+}
+
+// CacheConfig is the Redis response cache of the read endpoints
+type CacheConfig struct {
+	Enabled bool
+	// TTL is the longest a response is cached for, writes purge it sooner
+	TTL time.Duration
+}
+
+// AWSConfig is the S3 bucket files are stored in, also used for MinIO
+type AWSConfig struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	Region          string
+	Bucket          string
+}
+
+// StorageConfig selects and configures the storage backend
+type StorageConfig struct {
+	// Driver is local, s3 or minio
+	Driver string
+	// Root and BaseURL are for the local driver
+	Root    string
+	BaseURL string
+	// Endpoint is the MinIO (or other S3 compatible) server
+	Endpoint      string
+	URLExpiry     time.Duration
+	MaxUploadSize int64
+}
+
+// EmailConfig selects and configures the mailer and the email queue
+type EmailConfig struct {
+	// Driver is sendgrid, smtp, file or memory
+	Driver   string
+	From     string
+	FromName string
+	// Key is the SendGrid API key
+	Key string
+	// Dir is where the file driver writes messages
+	Dir          string
+	SMTP         SMTPConfig
+	MaxAttempts  int
+	RetryBackoff time.Duration
+}
+
+// SMTPConfig is the server the smtp driver sends through
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+// AccountConfig holds settings for user accounts
+type AccountConfig struct {
+	DeletionGracePeriod time.Duration
+}
+
+// LogConfig is where the application and access logs are written
+type LogConfig struct {
+	// Level is debug, info, warn or error. The access log has every request whatever the level.
+	Level string
+	// Output is stdout, file or both
+	Output string
+	// File and AccessFile are the log files of the file output
+	File       string
+	AccessFile string
+	// AccessFormat is clf, combined or json
+	AccessFormat string
+	// AccessSample is the share of successful requests in the access log, from 0 to 1.
+	// Requests that fail with a 4xx or 5xx status are always logged.
+	AccessSample float64
+	// Log files are rotated when they reach MaxSize bytes and when a RotateEvery period starts,
+	// 0 turns either off. MaxBackups rotated files are kept, all of them when 0, gzipped if Compress.
+	MaxSize     int64
+	RotateEvery time.Duration
+	MaxBackups  int
+	Compress    bool
+}
+
+// MetricsConfig is the Prometheus endpoint
+type MetricsConfig struct {
+	Enabled bool
+	// Path is where the metrics are served, outside of /v1
+	Path string
+}
+
+// TracingConfig is where OpenTelemetry traces are exported
+type TracingConfig struct {
+	Enabled bool
+	// Exporter is otlp, to send traces to a collector at Endpoint over gRPC, or stdout for local debugging
+	Exporter string
+	Endpoint string
+	// Insecure sends to the collector without TLS
+	Insecure bool
+	// SampleRatio is the share of new traces recorded, from 0 to 1. Traces started by a caller keep its decision.
+	SampleRatio float64
+	// ServiceName names the server in the traces
+	ServiceName string
+}
+
+// defaults for every key. Keys without a sensible default are still listed,
+// otherwise viper wouldn't look them up in the environment.
+var defaults = map[string]interface{}{
+	"settings.key":                "",
+	"settings.maxBodySize":        1 << 20,
+	"server.address":              ":5000",
+	"server.readTimeout":          "5m",
+	"server.readHeaderTimeout":    "10s",
+	"server.writeTimeout":         "5m",
+	"server.idleTimeout":          "2m",
+	"server.shutdownTimeout":      "30s",
+	"server.healthTimeout":        "2s",
+	"server.tls.mode":             "off",
+	"server.tls.certFile":         "",
+	"server.tls.keyFile":          "",
+	"server.tls.domains":          []string{},
+	"server.tls.email":            "",
+	"server.tls.directory":        "",
+	"server.tls.cacheDir":         "certs",
+	"server.tls.redirectAddress":  "",
+	"cors.allowedOrigins":         []string{"https://bookateria.net", "https://*.bookateria.net", "http://bookateria.net"},
+	"cors.allowedMethods":         []string{"GET", "POST", "PUT", "DELETE"},
+	"cors.allowedHeaders":         []string{"Accept", "Accept-Language", "Authorization", "Content-Type", "X-Request-ID", "traceparent", "tracestate"},
+	"cors.exposedHeaders":         []string{"X-Request-ID", "X-Cache", "Link", "Content-Language"},
+	"cors.allowCredentials":       false,
+	"cors.maxAge":                 "10m",
+	"cors.overrides":              []interface{}{},
+	"database.host":               "localhost",
+	"database.port":               5432,
+	"database.name":               "",
+	"database.user":               "",
+	"database.pass":               "",
+	"database.ssl":                "disable",
+	"database.maxOpenConns":       25,
+	"database.maxIdleConns":       10,
+	"database.connMaxLifetime":    "30m",
+	"database.connMaxIdleTime":    "5m",
+	"database.autoMigrate":        true,
+	"redis.address":               "localhost:6379",
+	"redis.password":              "",
+	"redis.database":              0,
+	"redis.poolSize":              0,
+	"redis.minIdleConns":          2,
+	"cache.enabled":               true,
+	"cache.ttl":                   "5m",
+	"aws.accessKeyID":             "",
+	"aws.secretAccessKey":         "",
+	"aws.region":                  "",
+	"aws.bucket":                  "",
+	"storage.driver":              "s3",
+	"storage.root":                "media",
+	"storage.baseURL":             "/media/",
+	"storage.endpoint":            "",
+	"storage.urlExpiry":           "15m",
+	"storage.maxUploadSize":       100 << 20,
+	"email.driver":                "sendgrid",
+	"email.from":                  "noreply@bookateria.net",
+	"email.fromName":              "Bookateria",
+	"email.key":                   "",
+	"email.dir":                   "email/outbox",
+	"email.smtp.host":             "",
+	"email.smtp.port":             587,
+	"email.smtp.username":         "",
+	"email.smtp.password":         "",
+	"email.maxAttempts":           5,
+	"email.retryBackoff":          "30s",
+	"account.deletionGracePeriod": "720h",
+	"log.level":                   "info",
+	"log.output":                  "file",
+	"log.file":                    "log/error.log",
+	"log.accessFile":              "log/access.log",
+	"log.accessFormat":            "json",
+	"log.accessSample":            1,
+	"log.maxSize":                 100 << 20,
+	"log.rotateEvery":             "24h",
+	"log.maxBackups":              14,
+	"log.compress":                true,
+	"metrics.enabled":             true,
+	"metrics.path":                "/metrics",
+	"tracing.enabled":             false,
+	"tracing.exporter":            "otlp",
+	"tracing.endpoint":            "localhost:4317",
+	"tracing.insecure":            false,
+	"tracing.sampleRatio":         1,
+	"tracing.serviceName":         "bookateria",
+}
+
+var (
+	once    sync.Once
+	current *Config
+	loadErr error
+)
+
+// Load reads and validates the configuration. It only happens once, later calls return the same result.
+// The error lists every missing or invalid setting; the Config is still returned alongside it.
+func Load() (*Config, error) {
+	once.Do(func() {
+		current, loadErr = read()
+	})
+	return current, loadErr
+}
+
+// Get returns the configuration, loading it if that hasn't happened yet. Errors are for Load to report.
+func Get() *Config {
+	config, _ := Load()
+	return config
+}
+
+// read builds the Config from the file, environment and defaults
+func read() (*Config, error) {
+	viperConfig := viper.New()
+	for key, value := range defaults {
+		viperConfig.SetDefault(key, value)
+	}
+	viperConfig.SetEnvPrefix("bookateria")
+	viperConfig.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viperConfig.AutomaticEnv()
+
+	file := os.Getenv("BOOKATERIA_CONFIG")
+	if file == "" {
+		file = "config.yaml"
+	}
+	viperConfig.SetConfigFile(file)
+
+	// Running off environment variables alone is fine, a broken file is not
+	var problems []string
+	if err := viperConfig.ReadInConfig(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		problems = append(problems, fmt.Sprintf("%s: %v", file, err))
+	}
+
+	config := &Config{}
+	if err := viperConfig.Unmarshal(config); err != nil {
+		problems = append(problems, err.Error())
+		return config, &ValidationError{Problems: problems}
+	}
+
+	problems = append(problems, config.Validate()...)
+	if len(problems) > 0 {
+		return config, &ValidationError{Problems: problems}
+	}
+	return config, nil
+}
+
+// ValidationError lists everything wrong with the configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate returns a description of every missing or invalid setting
+func (c *Config) Validate() []string {
+	var problems []string
+	required := func(key, value string) {
+		if strings.TrimSpace(value) == "" {
+			problems = append(problems, key+" is required")
+		}
+	}
+	positive := func(key string, value int64) {
+		if value <= 0 {
+			problems = append(problems, key+" must be greater than zero")
+		}
+	}
+	oneOf := func(key, value string, allowed ...string) {
+		for _, option := range allowed {
+			if value == option {
+				return
+			}
+		}
+		problems = append(problems, fmt.Sprintf("%s must be one of %s, not %q", key, strings.Join(allowed, ", "), value))
+	}
+
+	required("settings.key", c.Settings.Key)
+	positive("settings.maxBodySize", c.Settings.MaxBodySize)
+
+	required("server.address", c.Server.Address)
+	positive("server.readTimeout", int64(c.Server.ReadTimeout))
+	positive("server.readHeaderTimeout", int64(c.Server.ReadHeaderTimeout))
+	positive("server.writeTimeout", int64(c.Server.WriteTimeout))
+	positive("server.idleTimeout", int64(c.Server.IdleTimeout))
+	positive("server.shutdownTimeout", int64(c.Server.ShutdownTimeout))
+	positive("server.healthTimeout", int64(c.Server.HealthTimeout))
+	oneOf("server.tls.mode", c.Server.TLS.Mode, "off", "files", "acme", "self-signed")
+	switch c.Server.TLS.Mode {
+	case "files":
+		required("server.tls.certFile", c.Server.TLS.CertFile)
+		required("server.tls.keyFile", c.Server.TLS.KeyFile)
+	case "acme":
+		if len(c.Server.TLS.Domains) == 0 {
+			problems = append(problems, "server.tls.domains is required")
+		}
+		required("server.tls.cacheDir", c.Server.TLS.CacheDir)
+	}
+
+	corsPolicy := func(key string, origins []string, credentials bool, maxAge time.Duration) {
+		for _, origin := range origins {
+			if !validOrigin(origin) {
+				problems = append(problems, fmt.Sprintf("%s.allowedOrigins has an invalid origin %q", key, origin))
+			}
+			if origin == "*" && credentials {
+				problems = append(problems, key+".allowedOrigins can't be * with credentials allowed")
+			}
+		}
+		if maxAge < 0 {
+			problems = append(problems, key+".maxAge can't be negative")
+		}
+	}
+	corsPolicy("cors", c.CORS.AllowedOrigins, c.CORS.AllowCredentials, c.CORS.MaxAge)
+	for i, override := range c.CORS.Overrides {
+		key := fmt.Sprintf("cors.overrides[%d]", i)
+		if !strings.HasPrefix(override.PathPrefix, "/") {
+			problems = append(problems, fmt.Sprintf("%s.pathPrefix must start with /, not %q", key, override.PathPrefix))
+		}
+		origins, credentials := override.AllowedOrigins, c.CORS.AllowCredentials
+		if len(origins) == 0 {
+			origins = c.CORS.AllowedOrigins
+		}
+		if override.AllowCredentials != nil {
+			credentials = *override.AllowCredentials
+		}
+		corsPolicy(key, origins, credentials, override.MaxAge)
+	}
+
+	required("database.host", c.Database.Host)
+	required("database.name", c.Database.Name)
+	required("database.user", c.Database.User)
+	if c.Database.Port <= 0 || c.Database.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("database.port must be a valid port, not %d", c.Database.Port))
+	}
+	oneOf("database.ssl", c.Database.SSL, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	positive("database.maxOpenConns", int64(c.Database.MaxOpenConns))
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		problems = append(problems, "database.maxIdleConns must be between 0 and database.maxOpenConns")
+	}
+	if c.Database.ConnMaxLifetime < 0 || c.Database.ConnMaxIdleTime < 0 {
+		problems = append(problems, "database.connMaxLifetime and database.connMaxIdleTime can't be negative")
+	}
+
+	required("redis.address", c.Redis.Address)
+	if c.Redis.Database < 0 {
+		problems = append(problems, "redis.database can't be negative")
+	}
+	if c.Redis.PoolSize < 0 || c.Redis.MinIdleConns < 0 {
+		problems = append(problems, "redis.poolSize and redis.minIdleConns can't be negative")
+	}
+	if c.Cache.Enabled {
+		positive("cache.ttl", int64(c.Cache.TTL))
+	}
+
+	oneOf("storage.driver", c.Storage.Driver, "local", "s3", "minio")
+	switch c.Storage.Driver {
+	case "local":
+		required("storage.root", c.Storage.Root)
+		required("storage.baseURL", c.Storage.BaseURL)
+	case "minio":
+		required("storage.endpoint", c.Storage.Endpoint)
+		fallthrough
+	case "s3":
+		required("aws.accessKeyID", c.AWS.AccessKeyID)
+		required("aws.secretAccessKey", c.AWS.SecretAccessKey)
+		required("aws.region", c.AWS.Region)
+		required("aws.bucket", c.AWS.Bucket)
+	}
+	positive("storage.urlExpiry", int64(c.Storage.URLExpiry))
+	positive("storage.maxUploadSize", c.Storage.MaxUploadSize)
+
+	oneOf("email.driver", c.Email.Driver, "sendgrid", "smtp", "file", "memory")
+	switch c.Email.Driver {
+	case "sendgrid":
+		required("email.key", c.Email.Key)
+	case "smtp":
+		required("email.smtp.host", c.Email.SMTP.Host)
+		positive("email.smtp.port", int64(c.Email.SMTP.Port))
+	case "file":
+		required("email.dir", c.Email.Dir)
+	}
+	if _, err := mail.ParseAddress(c.Email.From); err != nil {
+		problems = append(problems, fmt.Sprintf("email.from must be an email address, not %q", c.Email.From))
+	}
+	positive("email.maxAttempts", int64(c.Email.MaxAttempts))
+	positive("email.retryBackoff", int64(c.Email.RetryBackoff))
+
+	positive("account.deletionGracePeriod", int64(c.Account.DeletionGracePeriod))
+
+	oneOf("log.level", strings.ToLower(c.Log.Level), "debug", "info", "warn", "error")
+	oneOf("log.output", c.Log.Output, "stdout", "file", "both")
+	if c.Log.Output != "stdout" {
+		required("log.file", c.Log.File)
+		required("log.accessFile", c.Log.AccessFile)
+	}
+	oneOf("log.accessFormat", c.Log.AccessFormat, "clf", "combined", "json")
+	if c.Log.AccessSample < 0 || c.Log.AccessSample > 1 {
+		problems = append(problems, fmt.Sprintf("log.accessSample must be between 0 and 1, not %v", c.Log.AccessSample))
+	}
+	if c.Log.MaxSize < 0 || c.Log.RotateEvery < 0 || c.Log.MaxBackups < 0 {
+		problems = append(problems, "log.maxSize, log.rotateEvery and log.maxBackups can't be negative")
+	}
+
+	if c.Metrics.Enabled && !strings.HasPrefix(c.Metrics.Path, "/") {
+		problems = append(problems, fmt.Sprintf("metrics.path must start with /, not %q", c.Metrics.Path))
+	}
+
+	if c.Tracing.Enabled {
+		oneOf("tracing.exporter", c.Tracing.Exporter, "otlp", "stdout")
+		if c.Tracing.Exporter == "otlp" {
+			required("tracing.endpoint", c.Tracing.Endpoint)
+		}
+		required("tracing.serviceName", c.Tracing.ServiceName)
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			problems = append(problems, fmt.Sprintf("tracing.sampleRatio must be between 0 and 1, not %v", c.Tracing.SampleRatio))
+		}
+	}
+
+	return problems
+}
+
+// Options are the go-redis client options for this connection
+func (r RedisConfig) Options() *redis.Options {
+	return &redis.Options{
+		Addr:         r.Address,
+		Password:     r.Password,
+		DB:           r.Database,
+		PoolSize:     r.PoolSize,
+		MinIdleConns: r.MinIdleConns,
+	}
+}
+
+// validOrigin checks an allowed origin is *, or a scheme and host, and maybe port, with at most one *
+func validOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	scheme := strings.Index(origin, "://")
+	if scheme <= 0 || strings.Count(origin, "*") > 1 {
+		return false
+	}
+	host := origin[scheme+3:]
+	return host != "" && !strings.ContainsAny(host, "/?#@")
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// valid reads a configuration with only the settings that have no default given, from a file
+func valid(t *testing.T) *Config {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(file, []byte(`
+settings:
+  key: secret
+database:
+  name: bookateria
+  user: bookateria
+storage:
+  driver: local
+email:
+  driver: memory
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("BOOKATERIA_CONFIG", file)
+	defer os.Unsetenv("BOOKATERIA_CONFIG")
+	config, err := read()
+	if err != nil {
+		t.Fatalf("the defaults don't make a valid configuration: %v", err)
+	}
+	return config
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(*Config)
+		problems []string
+	}{
+		{"defaults", func(*Config) {}, nil},
+		{"required", func(c *Config) { c.Settings.Key = " " }, []string{"settings.key is required"}},
+		{"positive", func(c *Config) { c.Storage.URLExpiry = 0 },
+			[]string{"storage.urlExpiry must be greater than zero"}},
+		{"one of", func(c *Config) { c.Database.SSL = "on" },
+			[]string{`database.ssl must be one of disable, allow, prefer, require, verify-ca, verify-full, not "on"`}},
+		{"database port", func(c *Config) { c.Database.Port = 70000 },
+			[]string{"database.port must be a valid port, not 70000"}},
+		{"idle connections", func(c *Config) { c.Database.MaxIdleConns = c.Database.MaxOpenConns + 1 },
+			[]string{"database.maxIdleConns must be between 0 and database.maxOpenConns"}},
+		{"cache ttl", func(c *Config) { c.Cache.TTL = 0 }, []string{"cache.ttl must be greater than zero"}},
+		{"cache ttl only when enabled", func(c *Config) {
+			c.Cache.Enabled = false
+			c.Cache.TTL = 0
+		}, nil},
+		{"s3", func(c *Config) { c.Storage.Driver = "s3" }, []string{
+			"aws.accessKeyID is required", "aws.secretAccessKey is required",
+			"aws.region is required", "aws.bucket is required",
+		}},
+		{"minio", func(c *Config) {
+			c.Storage.Driver = "minio"
+			c.AWS = AWSConfig{AccessKeyID: "id", SecretAccessKey: "key", Region: "us-east-1", Bucket: "files"}
+		}, []string{"storage.endpoint is required"}},
+		{"smtp", func(c *Config) { c.Email.Driver = "smtp" }, []string{"email.smtp.host is required"}},
+		{"sender", func(c *Config) { c.Email.From = "bookateria" },
+			[]string{`email.from must be an email address, not "bookateria"`}},
+		{"body size", func(c *Config) { c.Settings.MaxBodySize = 0 },
+			[]string{"settings.maxBodySize must be greater than zero"}},
+		{"log files", func(c *Config) {
+			c.Log.Output = "both"
+			c.Log.File, c.Log.AccessFile = "", ""
+		}, []string{"log.file is required", "log.accessFile is required"}},
+		{"log level is case insensitive", func(c *Config) { c.Log.Level = "DEBUG" }, nil},
+		{"access sample", func(c *Config) { c.Log.AccessSample = 1.5 },
+			[]string{"log.accessSample must be between 0 and 1, not 1.5"}},
+		{"log rotation", func(c *Config) { c.Log.MaxBackups = -1 },
+			[]string{"log.maxSize, log.rotateEvery and log.maxBackups can't be negative"}},
+		{"metrics path", func(c *Config) {
+			c.Metrics.Enabled = true
+			c.Metrics.Path = "metrics"
+		}, []string{`metrics.path must start with /, not "metrics"`}},
+		{"tracing", func(c *Config) {
+			c.Tracing.Enabled = true
+			c.Tracing.Exporter = "otlp"
+			c.Tracing.Endpoint = ""
+			c.Tracing.SampleRatio = 2
+		}, []string{"tracing.endpoint is required", "tracing.sampleRatio must be between 0 and 1, not 2"}},
+		{"tls mode", func(c *Config) { c.Server.TLS.Mode = "on" },
+			[]string{`server.tls.mode must be one of off, files, acme, self-signed, not "on"`}},
+		{"tls files", func(c *Config) { c.Server.TLS.Mode = "files" },
+			[]string{"server.tls.certFile is required", "server.tls.keyFile is required"}},
+		{"acme", func(c *Config) {
+			c.Server.TLS.Mode = "acme"
+			c.Server.TLS.CacheDir = ""
+		}, []string{"server.tls.domains is required", "server.tls.cacheDir is required"}},
+		{"health timeout", func(c *Config) { c.Server.HealthTimeout = 0 },
+			[]string{"server.healthTimeout must be greater than zero"}},
+		{"invalid origin", func(c *Config) { c.CORS.AllowedOrigins = []string{"bookateria.net"} },
+			[]string{`cors.allowedOrigins has an invalid origin "bookateria.net"`}},
+		{"any origin with credentials", func(c *Config) {
+			c.CORS.AllowedOrigins = []string{"*"}
+			c.CORS.AllowCredentials = true
+		}, []string{"cors.allowedOrigins can't be * with credentials allowed"}},
+		{"override takes the origins it leaves out", func(c *Config) {
+			c.CORS.AllowedOrigins = []string{"*"}
+			allow := true
+			c.CORS.Overrides = []CORSOverride{{PathPrefix: "account", AllowCredentials: &allow}}
+		}, []string{
+			`cors.overrides[0].pathPrefix must start with /, not "account"`,
+			"cors.overrides[0].allowedOrigins can't be * with credentials allowed",
+		}},
+		{"every problem is listed", func(c *Config) {
+			c.Redis.Address = ""
+			c.Email.MaxAttempts = 0
+			c.Account.DeletionGracePeriod = -time.Hour
+		}, []string{
+			"redis.address is required",
+			"email.maxAttempts must be greater than zero",
+			"account.deletionGracePeriod must be greater than zero",
+		}},
+	}
+
+	base := valid(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := *base
+			test.change(&config)
+			if problems := config.Validate(); !reflect.DeepEqual(problems, test.problems) {
+				t.Errorf("Validate() = %q, want %q", problems, test.problems)
+			}
+		})
+	}
+}
+
+func TestValidOrigin(t *testing.T) {
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"*", true},
+		{"https://bookateria.net", true},
+		{"https://*.bookateria.net", true},
+		{"http://localhost:*", true},
+		{"http://localhost:3000", true},
+		{"bookateria.net", false},
+		{"https://", false},
+		{"://bookateria.net", false},
+		{"https://bookateria.net/", false},
+		{"https://user@bookateria.net", false},
+		{"https://*.*.bookateria.net", false},
+	}
+
+	for _, test := range tests {
+		if got := validOrigin(test.origin); got != test.want {
+			t.Errorf("validOrigin(%q) = %v, want %v", test.origin, got, test.want)
+		}
+	}
+}
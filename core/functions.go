@@ -1,56 +1,39 @@
 package core
 
 import (
+	"bookateriago/config"
 	"bookateriago/log"
-	"context"
-	"fmt"
-	"mime/multipart"
+	"encoding/json"
 	"net/http"
-	"strconv"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/go-redis/redis/v8"
-	"github.com/spf13/viper"
 )
 
 type tokenClaims struct {
-	Email string `json:"email"`
+	Email  string `json:"email"`
+	UserID uint   `json:"user_id"`
 	jwt.StandardClaims
 }
 
-var (
-	viperConfig = ReadViper()
-	redisDB, _  = strconv.Atoi(fmt.Sprintf("%s", viperConfig.Get("redis.database")))
-	redisClient = redis.NewClient(&redis.Options{
-		Addr: fmt.Sprintf("%s", viperConfig.Get("redis.address")),
-		//Password: fmt.Sprintf("%s", viperConfig.Get("redis.password")),
-		DB: redisDB,
-	})
-	ctx = context.Background()
-)
-
-// ReadViper : A simple function utilizing the viper package for reading from configuration file.
-// Reads specifically from config.yaml located in the root directory.
-func ReadViper() *viper.Viper {
-	viperConfig := viper.New()
-	viperConfig.SetConfigFile("config.yaml")
-	_ = viperConfig.ReadInConfig()
+// Sessions checks tokens against the ones handed out at login, which are kept in Redis
+type Sessions struct {
+	client *redis.Client
+}
 
-	return viperConfig
+// NewSessions checks tokens against the ones stored in client
+func NewSessions(client *redis.Client) *Sessions {
+	return &Sessions{client: client}
 }
 
 // GetTokenEmail is used to get the token as well as email address of logged in users
 // It returns both the token and the email if the user is logged in and the token is valid
 // Else it returns nil and an empty string: "".
 // Reads the token from the request header and breaks it down to get the user.
-func GetTokenEmail(r *http.Request) (*jwt.Token, string) {
+func (s *Sessions) GetTokenEmail(r *http.Request) (*jwt.Token, string) {
 	authorization := r.Header.Get("Authorization")
-	viperConfig := ReadViper()
-	jwtKey := []byte(fmt.Sprintf("%s", viperConfig.Get("settings.key")))
+	jwtKey := []byte(config.Get().Settings.Key)
 	if authorization == "" {
 		//w.WriteHeader(http.StatusUnauthorized)
 		return nil, ""
@@ -69,94 +52,35 @@ func GetTokenEmail(r *http.Request) (*jwt.Token, string) {
 
 	email := claims.Email
 
-	storedOTP, err := redisClient.Get(ctx, email).Result()
-	log.ErrorHandler(err)
+	storedOTP, err := s.client.Get(r.Context(), email).Result()
+	if err != redis.Nil {
+		log.ErrorContext(r.Context(), err)
+	}
 
 	if storedOTP == "" || storedOTP != authorization {
 		return nil, ""
 	}
 
+	// Tokens issued before the user ID was added to them only have the email
+	if claims.UserID != 0 {
+		log.AddFields(r.Context(), log.Fields{"user_id": claims.UserID})
+	}
 	return token, email
 }
 
-// connectAWS connects to AWS with correct credentials and creates a session
-func connectAWS() *session.Session {
-	// This is used to connect to AWS with the credentials
-	accessKeyID := fmt.Sprintf("%s", viperConfig.Get("aws.accessKeyID"))
-	secretAccessKey := fmt.Sprintf("%s", viperConfig.Get("aws.secretAccessKey"))
-	bucketRegion := fmt.Sprintf("%s", viperConfig.Get("aws.region"))
-
-	sess, err := session.NewSession(
-		&aws.Config{
-			Credentials: credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
-			Region:      aws.String(bucketRegion),
+// SendDownload points the client to a signed download link that is valid for expiry.
+// Redirects by default. With ?redirect=false the link is returned as a DownloadStruct instead,
+// for clients that want to handle the download themselves.
+func SendDownload(w http.ResponseWriter, r *http.Request, url string, expiry time.Duration) {
+	if r.URL.Query().Get("redirect") == "false" {
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(DownloadStruct{
+			URL:       url,
+			ExpiresAt: time.Now().Add(expiry),
 		})
-
-	if err != nil {
-		fmt.Println(err)
-	}
-
-	return sess
-}
-
-// S3Upload takes a file from a multipart/form and uploads to an AWS S3 bucket
-// Pass in the session from the ConnectAWS function, the file from the multipart form
-// and the filename from header.filename
-// Returns true, the slug, and nil if successful
-func S3Upload(file multipart.File, filename string) (bool, string, error) {
-
-	sess := connectAWS()
-	bucketName := fmt.Sprintf("%s", viperConfig.Get("aws.bucket"))
-
-	uploader := s3manager.NewUploader(sess)
-	_, err := uploader.Upload(&s3manager.UploadInput{
-		ACL:    aws.String("public-read"),
-		Body:   file,
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(filename),
-	})
-
-	if err != nil {
-		return false, "", err
-	}
-
-	fileSlug := "https://" + bucketName + "." + "s3.amazonaws.com/" + filename
-	return true, fileSlug, nil
-}
-
-// ResponseData checks if a previous and next page exists for a certain endpoint
-// returns too boolean values. Previous and next
-func ResponseData(count int, r *http.Request) (int, bool, bool) {
-	prev, next := false, false
-	var page, pageSize int
-	if count != 0 {
-		var err error
-		if r.URL.Query().Get("page") == "" {
-			page = 1
-		} else {
-			page, err = strconv.Atoi(r.URL.Query().Get("page"))
-			if err != nil {
-				log.ErrorHandler(err)
-			}
-		}
-		if r.URL.Query().Get("page_size") == "" {
-			pageSize = 10
-		} else {
-			pageSize, err = strconv.Atoi(r.URL.Query().Get("page_size"))
-			if err != nil {
-				log.ErrorHandler(err)
-			}
-		}
-
-		if (page * pageSize) < count {
-			next = true
-		}
-
-		if page > 1 {
-			prev = true
-		}
-
+		log.ErrorContext(r.Context(), err)
+		return
 	}
 
-	return page, prev, next
+	http.Redirect(w, r, url, http.StatusFound)
 }
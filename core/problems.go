@@ -0,0 +1,77 @@
+package core
+
+import (
+	"bookateriago/i18n"
+	"bookateriago/log"
+	"bookateriago/requestid"
+	"encoding/json"
+	"net/http"
+)
+
+// ProblemType prefixes the code of a problem to make its type URI
+const ProblemType = "https://bookateria.net/problems/"
+
+// Problem is an RFC 7807 error body. Code is the machine readable version of Title,
+// and Errors lists what is wrong with each field of the request, if anything.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is a problem with a single field of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Field describes what is wrong with field. The message is looked up as field.<code> in the i18n catalog.
+func Field(field, code string) FieldError {
+	return FieldError{Field: field, Code: code}
+}
+
+// WriteProblem answers the request with the general response as an application/problem+json error,
+// along with whatever is wrong with individual fields.
+func WriteProblem(w http.ResponseWriter, r *http.Request, resp response, fields ...FieldError) {
+	language := i18n.FromRequest(r)
+	problem := Problem{
+		Type:      ProblemType + resp.key,
+		Title:     i18n.T(language, resp.key),
+		Status:    resp.status,
+		Instance:  r.URL.Path,
+		Code:      resp.key,
+		RequestID: requestid.FromContext(r.Context()),
+	}
+	for _, field := range fields {
+		field.Message = i18n.T(language, "field."+field.Code)
+		problem.Errors = append(problem.Errors, field)
+	}
+	if len(problem.Errors) > 0 {
+		problem.Detail = i18n.T(language, "problem.fields")
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(resp.status)
+	err := json.NewEncoder(w).Encode(problem)
+	log.ErrorContext(r.Context(), err)
+}
+
+// NotFoundHandler answers requests for routes that don't exist
+func NotFoundHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteProblem(w, r, FourOFour)
+	})
+}
+
+// MethodNotAllowedHandler answers requests with a method the route doesn't support
+func MethodNotAllowedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteProblem(w, r, FourOFive)
+	})
+}
@@ -1,30 +1,83 @@
 package core
 
+import (
+	"bookateriago/i18n"
+	"net/http"
+	"time"
+)
+
+// response is the general response body. key looks the message up in the i18n catalog,
+// and doubles as the machine readable code when the response is sent as a problem.
 type response struct {
+	status  int
+	key     string
 	Message string
 }
 
-type ResponseStruct struct {
-	Previous bool        `json:"previous"`
-	Next     bool        `json:"next"`
-	Page     int         `json:"page"`
-	Count    int64       `json:"count"`
-	Result   interface{} `json:"result"`
+// DownloadStruct is returned instead of a redirect when a client asks for a download link itself
+type DownloadStruct struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 var (
 	// TwoHundred general response for http code 200
-	TwoHundred = response{Message: "OK"}
+	TwoHundred = response{status: 200, key: "ok", Message: "OK"}
 	// FourHundred general response for http code 400
-	FourHundred = response{Message: "Invalid Request."}
+	FourHundred = response{status: 400, key: "invalid_request", Message: "Invalid Request."}
 	// FourOOne general response for http code 401
-	FourOOne = response{Message: "Access Denied."}
+	FourOOne = response{status: 401, key: "access_denied", Message: "Access Denied."}
+	// FourOThree response for http code 403
+	FourOThree = response{status: 403, key: "forbidden", Message: "Forbidden."}
 	// FourOFour general response for http code 404
-	FourOFour = response{Message: "Requested resource not found."}
+	FourOFour = response{status: 404, key: "not_found", Message: "Requested resource not found."}
+	// FourOFive response for http code 405
+	FourOFive = response{status: 405, key: "method_not_allowed", Message: "Method Not Allowed."}
 	// FourONine response for http code 409
-	FourONine = response{Message: "Conflict."}
+	FourONine = response{status: 409, key: "conflict", Message: "Conflict."}
+	// FourThirteen response for http code 413
+	FourThirteen = response{status: 413, key: "payload_too_large", Message: "Request Body Too Large."}
 	// FourTwoTwo general response for http code 422
-	FourTwoTwo = response{Message: "Your Request Could not be Processed."}
+	FourTwoTwo = response{status: 422, key: "unprocessable", Message: "Your Request Could not be Processed."}
 	// FiveHundred general response for http code 500
-	FiveHundred = response{Message: "Server Error."}
+	FiveHundred = response{status: 500, key: "server_error", Message: "Server Error."}
 )
+
+// StatusResponse returns the general response for an http status code
+func StatusResponse(code int) response {
+	switch code {
+	case 200:
+		return TwoHundred
+	case 400:
+		return FourHundred
+	case 401:
+		return FourOOne
+	case 403:
+		return FourOThree
+	case 404:
+		return FourOFour
+	case 405:
+		return FourOFive
+	case 409:
+		return FourONine
+	case 413:
+		return FourThirteen
+	case 422:
+		return FourTwoTwo
+	default:
+		return FiveHundred
+	}
+}
+
+// Localize translates a general response into the language the request asked for in Accept-Language
+func Localize(r *http.Request, message response) response {
+	message.Message = i18n.T(i18n.FromRequest(r), message.key)
+	return message
+}
+
+// WithCode is the response with a more specific code, e.g. FourHundred.WithCode("submission_limit").
+// The message is looked up under the new code, so it needs an entry in the i18n catalog.
+func (r response) WithCode(code string) response {
+	r.key = code
+	return r
+}
@@ -0,0 +1,217 @@
+// Package cors answers preflight requests and tells browsers which origins may read the responses of the
+// API, following the cors settings and their per-path overrides.
+package cors
+
+import (
+	"bookateriago/config"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// policy is a CORS policy from the settings, ready to be checked against requests
+type policy struct {
+	pathPrefix  string
+	anyOrigin   bool
+	origins     []origin
+	methods     map[string]bool
+	anyHeader   bool
+	headers     map[string]bool
+	allowed     string
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+// origin is an allowed origin, split around its * if it has one
+type origin struct {
+	prefix   string
+	suffix   string
+	wildcard bool
+}
+
+var (
+	defaultPolicy *policy
+	overrides     []*policy
+)
+
+// Setup builds the policies from the settings. It is meant to run once at startup, before Middleware is used.
+func Setup(settings config.CORSConfig) {
+	defaultPolicy = newPolicy("", settings.AllowedOrigins, settings.AllowedMethods, settings.AllowedHeaders,
+		settings.ExposedHeaders, settings.AllowCredentials, settings.MaxAge.Seconds())
+
+	overrides = nil
+	for _, override := range settings.Overrides {
+		merged := settings
+		if len(override.AllowedOrigins) > 0 {
+			merged.AllowedOrigins = override.AllowedOrigins
+		}
+		if len(override.AllowedMethods) > 0 {
+			merged.AllowedMethods = override.AllowedMethods
+		}
+		if len(override.AllowedHeaders) > 0 {
+			merged.AllowedHeaders = override.AllowedHeaders
+		}
+		if len(override.ExposedHeaders) > 0 {
+			merged.ExposedHeaders = override.ExposedHeaders
+		}
+		if override.AllowCredentials != nil {
+			merged.AllowCredentials = *override.AllowCredentials
+		}
+		if override.MaxAge > 0 {
+			merged.MaxAge = override.MaxAge
+		}
+		overrides = append(overrides, newPolicy(override.PathPrefix, merged.AllowedOrigins, merged.AllowedMethods,
+			merged.AllowedHeaders, merged.ExposedHeaders, merged.AllowCredentials, merged.MaxAge.Seconds()))
+	}
+	// The longest prefix is the most specific, it is tried first
+	sort.SliceStable(overrides, func(i, j int) bool {
+		return len(overrides[i].pathPrefix) > len(overrides[j].pathPrefix)
+	})
+}
+
+func newPolicy(pathPrefix string, origins, methods, headers, exposed []string, credentials bool, maxAge float64) *policy {
+	p := &policy{
+		pathPrefix:  pathPrefix,
+		methods:     map[string]bool{},
+		headers:     map[string]bool{},
+		allowed:     strings.Join(headers, ", "),
+		exposed:     strings.Join(exposed, ", "),
+		credentials: credentials,
+	}
+	if maxAge > 0 {
+		p.maxAge = strconv.Itoa(int(maxAge))
+	}
+	for _, allowed := range origins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" {
+			p.anyOrigin = true
+			continue
+		}
+		star := strings.Index(allowed, "*")
+		if star < 0 {
+			p.origins = append(p.origins, origin{prefix: allowed})
+			continue
+		}
+		p.origins = append(p.origins, origin{prefix: allowed[:star], suffix: allowed[star+1:], wildcard: true})
+	}
+	for _, method := range methods {
+		p.methods[strings.ToUpper(method)] = true
+	}
+	for _, header := range headers {
+		if header == "*" {
+			p.anyHeader = true
+		}
+		p.headers[strings.ToLower(header)] = true
+	}
+	return p
+}
+
+// policyFor is the policy of the override with the longest prefix of path, or the default one
+func policyFor(path string) *policy {
+	for _, override := range overrides {
+		if strings.HasPrefix(path, override.pathPrefix) {
+			return override
+		}
+	}
+	return defaultPolicy
+}
+
+// allowsOrigin checks the Origin header of a request against the allowed origins. A * matches one or more
+// subdomain labels, or a port.
+func (p *policy) allowsOrigin(requested string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	requested = strings.ToLower(requested)
+	for _, allowed := range p.origins {
+		if !allowed.wildcard {
+			if requested == allowed.prefix {
+				return true
+			}
+			continue
+		}
+		if len(requested) <= len(allowed.prefix)+len(allowed.suffix) ||
+			!strings.HasPrefix(requested, allowed.prefix) || !strings.HasSuffix(requested, allowed.suffix) {
+			continue
+		}
+		middle := requested[len(allowed.prefix) : len(requested)-len(allowed.suffix)]
+		if strings.Trim(middle, "abcdefghijklmnopqrstuvwxyz0123456789.-") == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders checks every header named in an Access-Control-Request-Headers list is allowed
+func (p *policy) allowsHeaders(requested string) bool {
+	if p.anyHeader {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header != "" && !p.headers[header] {
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware adds the CORS headers to the responses to allowed origins, and answers their preflight requests.
+// It wraps the whole router: preflights use OPTIONS, which no route is registered for.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := policyFor(r.URL.Path)
+		header := w.Header()
+		// Caches must not hand the headers given to one origin to another
+		header.Add("Vary", "Origin")
+
+		requested := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && requested != "" &&
+			r.Header.Get("Access-Control-Request-Method") != ""
+		if !preflight {
+			if requested != "" && p.allowsOrigin(requested) {
+				p.allowOrigin(header, requested)
+				if p.exposed != "" {
+					header.Set("Access-Control-Expose-Headers", p.exposed)
+				}
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		method := r.Header.Get("Access-Control-Request-Method")
+		requestedHeaders := r.Header.Get("Access-Control-Request-Headers")
+		// A refused preflight gets no CORS headers, which is how the browser learns it may not go on
+		if p.allowsOrigin(requested) && p.methods[method] && p.allowsHeaders(requestedHeaders) {
+			p.allowOrigin(header, requested)
+			header.Set("Access-Control-Allow-Methods", method)
+			if requestedHeaders != "" {
+				if p.anyHeader {
+					header.Set("Access-Control-Allow-Headers", requestedHeaders)
+				} else {
+					header.Set("Access-Control-Allow-Headers", p.allowed)
+				}
+			}
+			if p.maxAge != "" {
+				header.Set("Access-Control-Max-Age", p.maxAge)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allowOrigin lets requested read the response. With credentials the origin has to be named, * won't do.
+func (p *policy) allowOrigin(header http.Header, requested string) {
+	if p.anyOrigin && !p.credentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", requested)
+	if p.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,139 @@
+package cors
+
+import (
+	"bookateriago/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAllowsOrigin(t *testing.T) {
+	p := newPolicy("", []string{"https://bookateria.net", "https://*.bookateria.net", "http://localhost:*"},
+		nil, nil, nil, false, 0)
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://bookateria.net", true},
+		{"HTTPS://Bookateria.NET", true},
+		{"http://bookateria.net", false},
+		{"https://app.bookateria.net", true},
+		{"https://eu.app.bookateria.net", true},
+		{"https://.bookateria.net", false},
+		{"https://evil.com/.bookateria.net", false},
+		{"https://bookateria.net.evil.com", false},
+		{"https://evilbookateria.net", false},
+		{"http://localhost:3000", true},
+		{"http://localhost:", false},
+		{"http://localhost", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if got := p.allowsOrigin(test.origin); got != test.want {
+			t.Errorf("allowsOrigin(%q) = %v, want %v", test.origin, got, test.want)
+		}
+	}
+
+	if open := newPolicy("", []string{"*"}, nil, nil, nil, false, 0); !open.allowsOrigin("https://anything.example") {
+		t.Error("* doesn't allow every origin")
+	}
+}
+
+func TestAllowsHeaders(t *testing.T) {
+	p := newPolicy("", nil, nil, []string{"Authorization", "Content-Type"}, nil, false, 0)
+	tests := []struct {
+		headers string
+		want    bool
+	}{
+		{"", true},
+		{"authorization", true},
+		{"Content-Type, Authorization", true},
+		{"content-type,,", true},
+		{"Content-Type, X-Secret", false},
+	}
+
+	for _, test := range tests {
+		if got := p.allowsHeaders(test.headers); got != test.want {
+			t.Errorf("allowsHeaders(%q) = %v, want %v", test.headers, got, test.want)
+		}
+	}
+
+	if open := newPolicy("", nil, nil, []string{"*"}, nil, false, 0); !open.allowsHeaders("X-Anything") {
+		t.Error("* doesn't allow every header")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	allowCredentials := true
+	Setup(config.CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Authorization"},
+		ExposedHeaders: []string{"Link"},
+		MaxAge:         10 * time.Minute,
+		Overrides: []config.CORSOverride{{
+			PathPrefix:       "/v1/account",
+			AllowedOrigins:   []string{"https://bookateria.net"},
+			AllowCredentials: &allowCredentials,
+		}},
+	})
+	defer Setup(config.CORSConfig{})
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		origin      string
+		requested   string
+		status      int
+		allowOrigin string
+		credentials string
+		maxAge      string
+	}{
+		{"simple request", "GET", "/v1/document", "https://example.com", "", http.StatusTeapot, "*", "", ""},
+		{"no origin", "GET", "/v1/document", "", "", http.StatusTeapot, "", "", ""},
+		{"preflight", "OPTIONS", "/v1/document", "https://example.com", "POST", http.StatusNoContent, "*", "", "600"},
+		{"preflight for a method not allowed", "OPTIONS", "/v1/document", "https://example.com", "DELETE",
+			http.StatusNoContent, "", "", ""},
+		{"override names the origin", "GET", "/v1/account/language", "https://bookateria.net", "",
+			http.StatusTeapot, "https://bookateria.net", "true", ""},
+		{"override refuses other origins", "GET", "/v1/account/language", "https://example.com", "",
+			http.StatusTeapot, "", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.path, nil)
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			if test.requested != "" {
+				r.Header.Set("Access-Control-Request-Method", test.requested)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != test.status {
+				t.Errorf("status %d, want %d", w.Code, test.status)
+			}
+			header := w.Header()
+			if got := header.Get("Access-Control-Allow-Origin"); got != test.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin %q, want %q", got, test.allowOrigin)
+			}
+			if got := header.Get("Access-Control-Allow-Credentials"); got != test.credentials {
+				t.Errorf("Access-Control-Allow-Credentials %q, want %q", got, test.credentials)
+			}
+			if got := header.Get("Access-Control-Max-Age"); got != test.maxAge {
+				t.Errorf("Access-Control-Max-Age %q, want %q", got, test.maxAge)
+			}
+			if header.Values("Vary")[0] != "Origin" {
+				t.Errorf("Vary %q, want it to start with Origin", header.Values("Vary"))
+			}
+		})
+	}
+}
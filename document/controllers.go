@@ -2,11 +2,17 @@ package document
 
 import (
 	"bookateriago/account"
+	"bookateriago/audit"
+	"bookateriago/binding"
 	"bookateriago/core"
 	"bookateriago/log"
+	"bookateriago/pagination"
+	"bookateriago/slugs"
+	"bookateriago/storage"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"net/http"
 	"regexp"
@@ -14,18 +20,20 @@ import (
 	"strings"
 )
 
-var (
-	db = InitDatabase()
-)
+//handler Holds The Database And Storage The Document Routes Work With
+type handler struct {
+	db       *gorm.DB
+	store    storage.Storage
+	uploads  *storage.Uploads
+	sessions *core.Sessions
+}
+
+//uploadPrefix is where document files are kept in storage
+const uploadPrefix = "media/file"
 
 //FilterByTags fetches the documents that have the requested tag
-func FilterByTags(w http.ResponseWriter, r *http.Request) {
-	var (
-		documents   []Document
-		documentIDs []uint
-		tags        []Tag
-	)
-	w.Header().Set("Content-Type", "application/json")
+func (h *handler) FilterByTags(w http.ResponseWriter, r *http.Request) {
+	var documents []Document
 
 	//Get Queries From The URL
 	query := r.URL.Query().Get("filter")
@@ -33,43 +41,15 @@ func FilterByTags(w http.ResponseWriter, r *http.Request) {
 	//Split The Queries Into A Slice
 	filterTags := strings.Split(query, ",")
 
-	//Find Which Tags Contain The Specified Tag names And Store In The Tags Struct
-	db.Where("tag_name IN ?", filterTags).Find(&tags)
-
-	//Append Into The documentIDs Struct, The ID Of The Documents That Contain The Specified Tags
-	for _, tag := range tags {
-		documentIDs = append(documentIDs, tag.DocumentID)
-	}
-
-	db.Preload(clause.Associations).Scopes(Paginate(r)).Find(&documents, "id IN ?", documentIDs)
-	w.WriteHeader(http.StatusOK)
+	//Documents That Have Any Of The Specified Tags
+	tagged := h.db.WithContext(r.Context()).Model(&Tag{}).Select("document_id").Where("tag_name IN ?", filterTags)
 
-	var count int64
-	db.Model(&Document{}).Where("id IN ?", documentIDs).Count(&count)
-
-	page, prev, next := core.ResponseData(len(documents), r)
-
-	response := core.ResponseStruct{
-		Previous: prev,
-		Next:     next,
-		Page:     page,
-		Count:    count,
-		Result:   documents,
-	}
-
-	err := json.NewEncoder(w).Encode(response)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
-	return
+	pagination.List(w, r, h.db.WithContext(r.Context()).Model(&Document{}).Preload(clause.Associations).Where("id IN (?)", tagged), &documents)
 }
 
 //SearchDocuments returns documents whose fields match the search term
-func SearchDocuments(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("Here")
+func (h *handler) SearchDocuments(w http.ResponseWriter, r *http.Request) {
 	var documents []Document
-	var results []Document
-
-	w.Header().Set("Content-Type", "application/json")
 
 	searchTerm := r.URL.Query().Get("search")
 
@@ -78,9 +58,7 @@ func SearchDocuments(w http.ResponseWriter, r *http.Request) {
 
 	//If The Regexp Doesn't Compile, Throw An Error
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(core.FourTwoTwo)
-		log.ErrorHandler(err)
+		core.WriteProblem(w, r, core.FourHundred)
 		return
 	}
 
@@ -89,195 +67,130 @@ func SearchDocuments(w http.ResponseWriter, r *http.Request) {
 	//Split The Search Query Into Individual Words
 	searchWords := strings.Fields(finalSearchTerm)
 
-	var totalCount int64
-	var count int64
-
-	//Loop Through The Words
+	//Match Documents Whose Title, Author Or Summary Contain Any Of The Words
+	conditions := make([]string, 0, len(searchWords))
+	args := make([]interface{}, 0, 3*len(searchWords))
 	for _, word := range searchWords {
 		word = "%" + strings.ToLower(word) + "%"
-
-		//Search For Documents Whose Title Fields Match The Words
-		db.Scopes(Paginate(r)).Preload(clause.Associations).Where("lower(title) LIKE ?", "%"+word+"%").Or(
-			"lower(author) LIKE ?", "%"+word+"%").Or(
-			"lower(summary) LIKE ?", "%"+word+"%").Find(&results).Count(&count)
-		totalCount += count
-		documents = append(documents, results...)
-
+		conditions = append(conditions, "lower(title) LIKE ? OR lower(author) LIKE ? OR lower(summary) LIKE ?")
+		args = append(args, word, word, word)
 	}
-	page, prev, next := core.ResponseData(len(documents), r)
 
-	response := core.ResponseStruct{
-		Previous: prev,
-		Next:     next,
-		Page:     page,
-		Count:    totalCount,
-		Result:   documents,
+	//No Words Means Nothing Matches
+	search := "1 = 0"
+	if len(conditions) > 0 {
+		search = strings.Join(conditions, " OR ")
 	}
 
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(response)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
-
+	pagination.List(w, r, h.db.WithContext(r.Context()).Model(&Document{}).Preload(clause.Associations).Where(search, args...), &documents)
 }
 
 //GetDocuments fetches all documents in the database
-func GetDocuments(w http.ResponseWriter, r *http.Request) {
+func (h *handler) GetDocuments(w http.ResponseWriter, r *http.Request) {
 	var documents []Document
-	w.Header().Set("Content-Type", "application/json")
-	// Load data from DB
-	db.Scopes(Paginate(r)).Preload(clause.Associations).Find(&documents)
-
-	var count int64
-	var tempDocs []Document
-	db.Find(&tempDocs).Count(&count)
-
-	page, prev, next := core.ResponseData(len(tempDocs), r)
-
-	response := core.ResponseStruct{
-		Previous: prev,
-		Next:     next,
-		Page:     page,
-		Count:    count,
-		Result:   documents,
-	}
-
-	err := json.NewEncoder(w).Encode(response)
-	log.ErrorHandler(err)
+	pagination.List(w, r, h.db.WithContext(r.Context()).Model(&Document{}).Preload(clause.Associations), &documents)
 }
 
 //GetDocument fetches a specific document from the database
-func GetDocument(w http.ResponseWriter, r *http.Request) {
+func (h *handler) GetDocument(w http.ResponseWriter, r *http.Request) {
 	var document Document
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
-	documentID := params["id"]
-	ID, _ := strconv.ParseUint(documentID, 10, 0)
 
-	// Check If The Document Exists
-	if !xExists(uint(ID)) {
-		// If The Document Doesn't Exist
-		// Users Shouldn't Be Allowed To Modify What Doesn't Exists
+	//Documents Can Be Asked For By ID Or By Slug
+	query := h.db.WithContext(r.Context()).Preload(clause.Associations)
+	if ID, err := strconv.ParseUint(params["id"], 10, 0); err == nil {
+		query = query.Where("id = ?", ID)
+	} else {
+		query = query.Where("slug = ?", params["id"])
+	}
 
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
+	// Check If The Document Exists
+	if query.Limit(1).Find(&document).RowsAffected == 0 {
+		core.WriteProblem(w, r, core.FourOFour)
 		return
-
 	}
 
-	db.Preload(clause.Associations).Find(&document, "id = ?", documentID)
 	err := json.NewEncoder(w).Encode(document)
-	log.ErrorHandler(err)
+	log.ErrorContext(r.Context(), err)
 }
 
-//PostDocument puts a provided document into the db
-func PostDocument(w http.ResponseWriter, r *http.Request) {
-	var (
-		category Category
-		document Document
-		tags     []Tag
-		tag      Tag
-		email    string
-		user     account.User
-	)
-
-	w.Header().Set("Content-Type", "multipart/form-data")
+//DownloadDocument sends logged in users to a short lived link for the document file
+func (h *handler) DownloadDocument(w http.ResponseWriter, r *http.Request) {
+	var document Document
 
 	//Checks If Current User Is Logged In
-	if _, email = core.GetTokenEmail(r); email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
+	if _, email := h.sessions.GetTokenEmail(r); email == "" {
+		w.Header().Set("Content-Type", "application/json")
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
-	//Creates memory space to store form-data
-	err := r.ParseMultipartForm(32 << 20)
-	if err != nil {
-		log.ErrorHandler(err)
-	}
-
-	//Check for user attached to mail
-	db.Find(&user, "email = ?", strings.ToLower(email))
-	reg, err := regexp.Compile("[^a-zA-Z0-9-]+")
+	params := mux.Vars(r)
+	ID, _ := strconv.ParseUint(params["id"], 10, 0)
 
-	//If The Regexp Doesn't Compile, Throw An Error
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(core.FourTwoTwo)
-		log.ErrorHandler(err)
+	// Check If The Document Exists
+	if !h.xExists(r.Context(), uint(ID)) {
+		w.Header().Set("Content-Type", "application/json")
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
-	//Validate The Title Field
-	title, err := validate(r.FormValue("title"))
+	h.db.WithContext(r.Context()).Find(&document, "id = ?", ID)
 
-	//If The Title Field Is Not Valid Throw An Error
+	//Sign A Link To The Private File
+	expiry := storage.URLExpiry()
+	url, err := h.store.SignedURL(r.Context(), document.FileSlug, expiry)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(core.FourTwoTwo)
-		log.ErrorHandler(err)
+		log.ErrorContext(r.Context(), err)
+		w.Header().Set("Content-Type", "application/json")
+		core.WriteProblem(w, r, core.FiveHundred)
 		return
 	}
 
-	//Validate The Author Field
-	author, err := validate(r.FormValue("author"))
+	h.db.WithContext(r.Context()).Model(&document).UpdateColumn("downloads", gorm.Expr("downloads + ?", 1))
+	core.SendDownload(w, r, url, expiry)
+}
 
-	//If The Author Field Is Not Valid, Throw An Error
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(core.FourTwoTwo)
-		log.ErrorHandler(err)
-		return
-	}
+//PostDocument puts a provided document into the db
+func (h *handler) PostDocument(w http.ResponseWriter, r *http.Request) {
+	var (
+		document Document
+		email    string
+		user     account.User
+	)
 
-	//Default Value For Edition
-	edition := 0
+	w.Header().Set("Content-Type", "multipart/form-data")
 
-	//Check If The Edition Sent By The User Is Not Empty
-	if r.FormValue("edition") != "" {
-		var err error
-		edition, err = strconv.Atoi(r.FormValue("edition"))
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(core.FourONine)
-			log.ErrorHandler(err)
-			return
-		}
+	//Checks If Current User Is Logged In
+	if _, email = h.sessions.GetTokenEmail(r); email == "" {
+		core.WriteProblem(w, r, core.FourOOne)
+		return
 	}
 
-	//Get tags from request and split into a slice
-	strTags := strings.Split(r.FormValue("tags"), ",")
-
-	//Parse tags and store into the Tags model
-	for _, strTag := range strTags {
-		tag.TagName = strings.TrimSpace(strTag)
-		tag.Slug = strings.ReplaceAll(strings.ToLower(tag.TagName), " ", "-")
-		tag.Slug = reg.ReplaceAllString(tag.Slug, "")
-		tags = append(tags, tag)
+	//Decode And Validate The Form, Including The File
+	var form documentForm
+	if !binding.Form(w, r, &form, storage.MaxUploadSize()) {
+		return
 	}
 
-	//Parse The Categories
-	category.CategoryName = strings.TrimSpace(r.FormValue("category"))
-	category.Slug = strings.ReplaceAll(strings.ToLower(category.CategoryName), " ", "-")
+	//Check for user attached to mail
+	h.db.WithContext(r.Context()).Find(&user, "email = ?", strings.ToLower(email))
 
 	//Store documents info
 	document = Document{
-		Title:    title,
-		Author:   author,
-		Edition:  edition,
-		Tags:     tags,
-		Summary:  r.FormValue("summary"),
+		Title:    titleCase(form.Title),
+		Author:   titleCase(form.Author),
+		Edition:  form.Edition,
+		Tags:     parseTags(form.Tags),
+		Summary:  form.Summary,
 		Uploader: user,
-		Category: category,
+		Category: parseCategory(form.Category),
 	}
 
 	//Checks if the document is a duplicate
-	if checkDuplicate(&document) {
-		w.WriteHeader(http.StatusConflict)
-		err := json.NewEncoder(w).Encode(core.FourONine)
-		log.ErrorHandler(err)
+	if h.checkDuplicate(r.Context(), &document) {
+		core.WriteProblem(w, r, core.FourONine.WithCode("duplicate_document"))
 		return
 	}
 	/*
@@ -288,23 +201,21 @@ func PostDocument(w http.ResponseWriter, r *http.Request) {
 	*/
 
 	//ProcessFile For Uploading To S3
-	file, header, err := r.FormFile("file")
+	header := form.File
+	file, err := header.Open()
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		err = json.NewEncoder(w).Encode(core.FourHundred)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 400)
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
 		return
 	}
+	defer file.Close()
 
 	//Split The File name Using A Dot As The Delimiter
 	fileExtension := strings.Split(header.Filename, ".")
 
 	//Check If The File Has An Extension
 	if len(fileExtension) < 2 {
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(core.FourTwoTwo)
-		log.ErrorHandler(err)
+		core.WriteProblem(w, r, core.FourHundred, core.Field("file", "extension_required"))
 		return
 	}
 
@@ -312,206 +223,300 @@ func PostDocument(w http.ResponseWriter, r *http.Request) {
 	fileName := strings.Join(strings.Fields(document.Title), "-") + "-" + strings.Join(strings.Fields(document.Author), "-") +
 		"-" + fmt.Sprint(document.Edition) + "-bookateria.net." + fileExtension[len(fileExtension)-1]
 
-	//Initiate An Upload To S3 Server
-	status, fileSlug, err := core.S3Upload(file, "media/file/"+fileName)
+	//Upload The File To The Configured Storage Backend
+	fileKey := uploadPrefix + "/" + fileName
+	err = h.store.Put(r.Context(), fileKey, file, header.Header.Get("Content-Type"))
 
 	//Check If The Upload Was Successful
-	if !status {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.ErrorHandler(err)
-		err = json.NewEncoder(w).Encode(core.FiveHundred)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 500)
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
 		return
 	}
 
-	//Gets document slug from request and stores it into the document
-	slug := strings.ToLower(strings.ReplaceAll(document.Title+"-"+document.Author+"-"+fmt.Sprint(edition), " ", "-"))
-	slug = reg.ReplaceAllString(slug, "")
-	document.Slug = slug
-	document.FileSlug = fileSlug
+	document.FileSlug = fileKey
 
-	//Create an entry for the document in the database
-	db.Create(&document)
+	//Create An Entry For The Document In The Database, Under A Slug No Other Document Has
+	err = slugs.Create(r.Context(), h.db, "documents", slugText(&document), func(tx *gorm.DB, slug string) error {
+		document.Slug = slug
+		if err := tx.Create(&document).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Create, EntityType: "document", EntityID: document.ID, After: document,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
 	err = json.NewEncoder(w).Encode(document)
-	log.ErrorHandler(err)
+	log.ErrorContext(r.Context(), err)
+}
+
+//RequestDocumentUpload hands out a slot for uploading a document file straight to storage.
+//The document itself is created by FinalizeDocumentUpload once the file is there.
+func (h *handler) RequestDocumentUpload(w http.ResponseWriter, r *http.Request) {
+	var request storage.UploadRequest
+	w.Header().Set("Content-Type", "application/json")
+
+	//Checks If Current User Is Logged In
+	_, email := h.sessions.GetTokenEmail(r)
+	if email == "" {
+		core.WriteProblem(w, r, core.FourOOne)
+		return
+	}
+
+	if !binding.JSON(w, r, &request) {
+		return
+	}
+
+	slot, err := h.uploads.NewUpload(r.Context(), strings.ToLower(email), uploadPrefix, request)
+	if err != nil {
+		status := storage.UploadErrorStatus(err)
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.StatusResponse(status))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(slot)
+	log.ErrorContext(r.Context(), err)
+}
+
+//FinalizeDocumentUpload creates the document for a file uploaded through RequestDocumentUpload.
+//The file has to match the size and checksum given when the slot was requested.
+func (h *handler) FinalizeDocumentUpload(w http.ResponseWriter, r *http.Request) {
+	var (
+		request  documentUploadRequest
+		document Document
+		user     account.User
+	)
+	w.Header().Set("Content-Type", "application/json")
+
+	//Checks If Current User Is Logged In
+	_, email := h.sessions.GetTokenEmail(r)
+	if email == "" {
+		core.WriteProblem(w, r, core.FourOOne)
+		return
+	}
+
+	if !binding.JSON(w, r, &request) {
+		return
+	}
+
+	h.db.WithContext(r.Context()).Find(&user, "email = ?", strings.ToLower(email))
+	document = Document{
+		Title:    titleCase(request.Title),
+		Author:   titleCase(request.Author),
+		Edition:  request.Edition,
+		Tags:     parseTags(request.Tags),
+		Summary:  request.Summary,
+		Uploader: user,
+		Category: parseCategory(request.Category),
+	}
+
+	//Checks if the document is a duplicate
+	if h.checkDuplicate(r.Context(), &document) {
+		core.WriteProblem(w, r, core.FourONine.WithCode("duplicate_document"))
+		return
+	}
+
+	//Make Sure The Uploaded File Is The One That Was Promised
+	upload, err := h.uploads.FinishUpload(r.Context(), strings.ToLower(email), uploadPrefix, request.UploadID)
+	if err != nil {
+		status := storage.UploadErrorStatus(err)
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.StatusResponse(status))
+		return
+	}
+
+	document.FileSlug = upload.Key
+	document.Size = float64(upload.Size)
+
+	err = slugs.Create(r.Context(), h.db, "documents", slugText(&document), func(tx *gorm.DB, slug string) error {
+		document.Slug = slug
+		if err := tx.Create(&document).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Create, EntityType: "document", EntityID: document.ID, After: document,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(document)
+	log.ErrorContext(r.Context(), err)
 }
 
 //UpdateDocument overwrites the details of a specified document with the provided ones.
-func UpdateDocument(w http.ResponseWriter, r *http.Request) {
+func (h *handler) UpdateDocument(w http.ResponseWriter, r *http.Request) {
 	var (
 		document Document
-		temp     Document
+		temp     documentUpdate
 		email    string
 	)
 
 	w.Header().Set("Content-Type", "application/json")
 
 	//Checks If Current User Is Logged In
-	if _, email = core.GetTokenEmail(r); email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
+	if _, email = h.sessions.GetTokenEmail(r); email == "" {
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
-	//Decode The Request Into A Temporary Document Variable
-	err := json.NewDecoder(r.Body).Decode(&temp)
-	log.ErrorHandler(err)
 	params := mux.Vars(r)
 
 	//Parse The ID To Be Updated
 	idToUpdate, err := strconv.ParseUint(params["id"], 10, 0)
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(core.FourTwoTwo)
-		log.ErrorHandler(err)
+		core.WriteProblem(w, r, core.FourHundred)
 		return
 	}
 
 	// Check If The Document Exists
-	if !xExists(uint(idToUpdate)) {
+	if !h.xExists(r.Context(), uint(idToUpdate)) {
 		// If The Document Doesn't Exist
 		// Users Shouldn't Be Allowed To Modify What Doesn't Exist
 
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 
 	}
 
 	//Gets The Document With The Specified ID
-	db.Preload(clause.Associations).Find(&document, "id = ?", idToUpdate)
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Find(&document, "id = ?", idToUpdate)
 
 	//Check If The Person Updating Is Authorized To Do So.
 	if email != document.Uploader.Email {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
+		core.WriteProblem(w, r, core.FourOThree)
+		return
+	}
+
+	//Decode And Validate The Changes
+	if !binding.JSON(w, r, &temp) {
 		return
 	}
+	before := audit.Snapshot(document)
 
 	reg, err := regexp.Compile("[^a-zA-Z0-9-]+")
 
 	//If The Regexp Doesn't Compile, Throw An Error
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(core.FourTwoTwo)
-		log.ErrorHandler(err)
+		core.WriteProblem(w, r, core.FourHundred)
 		return
 	}
 
-	//Check If The Title Is To Be Updated
-	if temp.Title != "" {
-		title, err := validate(temp.Title)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(core.FourTwoTwo)
-			log.ErrorHandler(err)
-			return
-		}
-		document.Title = title
+	//Only The Fields That Were Sent Are Updated
+	if temp.Title != nil {
+		document.Title = titleCase(*temp.Title)
 	}
-
-	//Check If The Author Is To Be Updated
-	if temp.Author != "" {
-
-		//Validate The Title Field
-		author, err := validate(temp.Author)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(core.FourTwoTwo)
-			log.ErrorHandler(err)
-			return
-		}
-		document.Author = author
+	if temp.Author != nil {
+		document.Author = titleCase(*temp.Author)
 	}
-
-	if temp.Summary != "" {
-		document.Summary = strings.Join(strings.Fields(temp.Summary), " ")
+	if temp.Summary != nil {
+		document.Summary = strings.Join(strings.Fields(*temp.Summary), " ")
 	}
-
-	//Check If The Edition Is To Be Updated
-	if document.Edition != 0 {
-
-		//Check If Edition Is An Integer
-		edition, err := strconv.Atoi(fmt.Sprint(temp.Edition))
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(core.FourTwoTwo)
-			log.ErrorHandler(err)
-			return
-		}
-
-		document.Edition = edition
+	if temp.Edition != nil {
+		document.Edition = *temp.Edition
 	}
 
-	//Check If Tags Are Empty
-	if len(temp.Tags) > 0 {
-
-		//Parse Tags If They're Not Empty
-		for _, tag := range temp.Tags {
-			slug := strings.ReplaceAll(strings.ToLower(tag.TagName), " ", "-")
-			tag.Slug = reg.ReplaceAllString(slug, "")
-			document.Tags = append(document.Tags, tag)
-		}
+	//Parse The New Tags
+	for _, tag := range temp.Tags {
+		name := strings.TrimSpace(tag.TagName)
+		slug := strings.ReplaceAll(strings.ToLower(name), " ", "-")
+		document.Tags = append(document.Tags, Tag{TagName: name, Slug: reg.ReplaceAllString(slug, "")})
 	}
 
 	//Parse Categories Too
-	if temp.Category.CategoryName != "" {
-		document.Category.CategoryName = temp.Category.CategoryName
+	if temp.Category != nil {
+		document.Category.CategoryName = strings.TrimSpace(temp.Category.CategoryName)
 		document.Category.Slug = strings.ReplaceAll(document.Category.CategoryName, " ", "-")
 	}
 
-	//Gets document slug from request and stores it into the document
-	slug := strings.ToLower(strings.ReplaceAll(document.Title+"-"+document.Author+"-"+fmt.Sprint(document.Edition), " ", "-"))
-	slug = reg.ReplaceAllString(slug, "")
-	document.Slug = slug
-
-	//Save The Document
-	db.Save(&document)
+	//Save The Document. The Slug Only Changes With The Title, Author Or Edition,
+	//And Links To The Old One Are Redirected To The New One
+	err = slugs.Update(r.Context(), h.db, "documents", document.ID, document.Slug, slugText(&document), func(tx *gorm.DB, slug string) error {
+		document.Slug = slug
+		if err := tx.Save(&document).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Update, EntityType: "document", EntityID: document.ID,
+			Before: before, After: document,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
 	err = json.NewEncoder(w).Encode(document)
-	log.ErrorHandler(err)
+	log.ErrorContext(r.Context(), err)
 }
 
-//DeleteDocument removes a specified document from the DB
-func DeleteDocument(w http.ResponseWriter, r *http.Request) {
+//DeleteDocument removes a specified document from the DB. Only its uploader can delete it.
+func (h *handler) DeleteDocument(w http.ResponseWriter, r *http.Request) {
 	var (
 		document Document
-		category Category
-		tags     []Tag
+		email    string
 	)
 
+	//Checks If Current User Is Logged In
+	if _, email = h.sessions.GetTokenEmail(r); email == "" {
+		core.WriteProblem(w, r, core.FourOOne)
+		return
+	}
+
 	params := mux.Vars(r)
 	id := params["id"]
 	idInUint, _ := strconv.ParseUint(id, 10, 64)
 	idToDelete := uint(idInUint)
 
 	//Check If The Document to Delete Exists
-	if !xExists(idToDelete) {
+	if !h.xExists(r.Context(), idToDelete) {
 
 		//Deletion Of Non-Existent Documents Is Not Permitted
 		//Throw An Error
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 
 	}
 
-	//Load The Tags Associated With The Document To Delete
-	db.Find(&tags, "document_id = ?", idToDelete)
+	//Gets The Document With The Specified ID
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Find(&document, "id = ?", idToDelete)
 
-	for _, tag := range tags {
-		db.Delete(&tag)
+	//Check If The Person Deleting Is Authorized To Do So.
+	if email != document.Uploader.Email {
+		core.WriteProblem(w, r, core.FourOThree)
+		return
 	}
 
-	//Delete The Document Reference From The Category Table
-	db.Where("document_id = ?", idToDelete).Delete(&category)
-
-	//Delete The Document
-	db.Where("id = ?", idToDelete).Delete(&document)
+	//Delete The Tags, The Category And The Document Together, Along With The Record Of It
+	err := h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", idToDelete).Delete(&Tag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("document_id = ?", idToDelete).Delete(&Category{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", idToDelete).Delete(&Document{}).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Delete, EntityType: "document", EntityID: idToDelete, Before: document,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -1,89 +1,57 @@
 package document
 
 import (
-	"bookateriago/core"
-	"bookateriago/log"
-	"errors"
+	"context"
 	"fmt"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
-	"net/http"
-	"strconv"
+	"regexp"
 	"strings"
 )
 
-func InitDatabase() *gorm.DB {
-	viperConfig := core.ReadViper()
+// slugRegex matches everything that isn't allowed in a slug
+var slugRegex = regexp.MustCompile("[^a-zA-Z0-9-]+")
 
-	var (
-		dbName = viperConfig.Get("database.name")
-		port   = viperConfig.Get("database.port")
-		pass   = viperConfig.Get("database.pass")
-		user   = viperConfig.Get("database.user")
-		host   = viperConfig.Get("database.host")
-		ssl    = viperConfig.Get("database.ssl")
-	)
-	postgresConnection := fmt.Sprintf("host=%s port=%d user=%s dbname=%s password=%s sslmode=%s", host, port, user, dbName, pass, ssl)
-	db, err := gorm.Open(postgres.Open(postgresConnection), &gorm.Config{})
-	log.ErrorHandler(err)
-
-	err = db.AutoMigrate(&Document{})
-	err = db.AutoMigrate(&Tag{})
-	err = db.AutoMigrate(&Category{})
-
-	log.ErrorHandler(err)
-	return db
-}
-
-func checkDuplicate(document *Document) bool {
+func (h *handler) checkDuplicate(ctx context.Context, document *Document) bool {
 	var count int64
-	db.Model(&Document{}).Where("title LIKE ? AND edition = ? AND author LIKE ? ", document.Title, document.Edition, document.Author).Count(&count)
+	h.db.WithContext(ctx).Model(&Document{}).Where("title LIKE ? AND edition = ? AND author LIKE ? ", document.Title, document.Edition, document.Author).Count(&count)
 	return count > 0
 }
 
-func xExists(id uint) bool {
+func (h *handler) xExists(ctx context.Context, id uint) bool {
 	var count int64
-	db.Model(&Document{}).Where("id = ?", id).Count(&count)
+	h.db.WithContext(ctx).Model(&Document{}).Where("id = ?", id).Count(&count)
 	return count > 0
 }
 
-/*validate=========================
-params: r type: http.Request
-Returns: string, string, int, error
+/*titleCase=========================
+params: field type: string
+Returns: the field with single spaces, in title case
 ===================================*/
-func validate(field string) (string, error) {
-
-	field = strings.ToLower(strings.TrimSpace(field))
-	//author := strings.TrimSpace(fields["author"])
-
-	/*title = strings.ToLower(title)
-	author = strings.ToLower(author)*/
+func titleCase(field string) string {
+	field = strings.Join(strings.Fields(strings.ToLower(field)), " ")
+	return strings.Title(field)
+}
 
-	if field != "" {
-		field = strings.Join(strings.Fields(field), " ")
-		return strings.Title(field), nil
+// parseTags turns a comma separated list of tag names into tags
+func parseTags(raw string) []Tag {
+	var tags []Tag
+	for _, name := range strings.Split(raw, ",") {
+		tag := Tag{TagName: strings.TrimSpace(name)}
+		tag.Slug = strings.ReplaceAll(strings.ToLower(tag.TagName), " ", "-")
+		tag.Slug = slugRegex.ReplaceAllString(tag.Slug, "")
+		tags = append(tags, tag)
 	}
-
-	return "", errors.New("either title or author is empty")
-
+	return tags
 }
 
-func Paginate(r *http.Request) func(db *gorm.DB) *gorm.DB {
-	return func(db *gorm.DB) *gorm.DB {
-		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-		if page == 0 {
-			page = 1
-		}
-
-		pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
-		switch {
-		case pageSize > 50:
-			pageSize = 50
-		case pageSize <= 0:
-			pageSize = 10
-		}
+// parseCategory builds the category with the given name
+func parseCategory(name string) Category {
+	category := Category{CategoryName: strings.TrimSpace(name)}
+	category.Slug = strings.ReplaceAll(strings.ToLower(category.CategoryName), " ", "-")
+	return category
+}
 
-		offset := (page - 1) * pageSize
-		return db.Offset(offset).Limit(pageSize)
-	}
+// slugText is what the slug of a document is made from: its title, author and edition
+func slugText(document *Document) string {
+	return document.Title + " " + document.Author + " " + fmt.Sprint(document.Edition)
 }
+
@@ -1,6 +1,7 @@
 package document
 
 import "bookateriago/account"
+import "mime/multipart"
 import "time"
 
 type Category struct {
@@ -35,3 +36,45 @@ type Document struct {
 	Uploader   account.User `json:"uploader"`
 	Category   Category     `json:"category"`
 }
+
+// documentForm is the form sent to upload a document through the API server
+type documentForm struct {
+	Title    string                `form:"title" validate:"required,max=255"`
+	Author   string                `form:"author" validate:"required,max=255"`
+	Edition  int                   `form:"edition" validate:"min=0"`
+	Summary  string                `form:"summary" validate:"max=5000"`
+	Tags     string                `form:"tags" validate:"max=500"`
+	Category string                `form:"category" validate:"max=100"`
+	File     *multipart.FileHeader `form:"file" validate:"required"`
+}
+
+// documentUploadRequest holds the document details sent to finalize a direct upload
+type documentUploadRequest struct {
+	UploadID string `json:"upload_id" validate:"required"`
+	Title    string `json:"title" validate:"required,max=255"`
+	Author   string `json:"author" validate:"required,max=255"`
+	Edition  int    `json:"edition" validate:"min=0"`
+	Summary  string `json:"summary" validate:"max=5000"`
+	Tags     string `json:"tags" validate:"max=500"`
+	Category string `json:"category" validate:"max=100"`
+}
+
+// documentUpdate holds the document details that can be changed. Fields that are left out keep their value.
+type documentUpdate struct {
+	Title    *string          `json:"title" validate:"required,max=255"`
+	Author   *string          `json:"author" validate:"required,max=255"`
+	Edition  *int             `json:"edition" validate:"min=0"`
+	Summary  *string          `json:"summary" validate:"max=5000"`
+	Tags     []tagRequest     `json:"tags"`
+	Category *categoryRequest `json:"category"`
+}
+
+// tagRequest is a tag added to a document
+type tagRequest struct {
+	TagName string `json:"tag_name" validate:"required,max=50"`
+}
+
+// categoryRequest is the category a document is moved to
+type categoryRequest struct {
+	CategoryName string `json:"category_name" validate:"required,max=100"`
+}
@@ -1,16 +1,28 @@
 package document
 
-import "github.com/gorilla/mux"
+import (
+	"bookateriago/app"
+	"bookateriago/slugs"
+
+	"github.com/gorilla/mux"
+)
 
 // Router contains all routes for documents feature
-func Router(router *mux.Router) *mux.Router {
-	router.HandleFunc("", SearchDocuments).Queries("search", "{search}").Methods("GET")
-	router.HandleFunc("", FilterByTags).Queries("filter", "{filter}").Methods("GET")
-	router.HandleFunc("", GetDocuments).Methods("GET")
-	router.HandleFunc("/{id}", GetDocument).Methods("GET")
-	router.HandleFunc("", PostDocument).Methods("POST")
-	router.HandleFunc("/{id}", UpdateDocument).Methods("PUT")
-	router.HandleFunc("/{id}", DeleteDocument).Methods("DELETE")
+func Router(router *mux.Router, a *app.App) *mux.Router {
+	h := &handler{db: a.DB, store: a.Storage, uploads: a.Uploads, sessions: a.Sessions}
+
+	router.Use(slugs.Redirects(a.DB, "documents", "id"))
+
+	router.HandleFunc("", a.Cache.Cached(h.SearchDocuments, "documents")).Queries("search", "{search}").Methods("GET")
+	router.HandleFunc("", a.Cache.Cached(h.FilterByTags, "documents")).Queries("filter", "{filter}").Methods("GET")
+	router.HandleFunc("", a.Cache.Cached(h.GetDocuments, "documents")).Methods("GET")
+	router.HandleFunc("/{id}", a.Cache.Cached(h.GetDocument, "documents")).Methods("GET")
+	router.HandleFunc("/{id}/download", h.DownloadDocument).Methods("GET")
+	router.HandleFunc("", a.Cache.Invalidates(h.PostDocument, "documents")).Methods("POST")
+	router.HandleFunc("/upload", h.RequestDocumentUpload).Methods("POST")
+	router.HandleFunc("/upload/finalize", a.Cache.Invalidates(h.FinalizeDocumentUpload, "documents")).Methods("POST")
+	router.HandleFunc("/{id}", a.Cache.Invalidates(h.UpdateDocument, "documents")).Methods("PUT")
+	router.HandleFunc("/{id}", a.Cache.Invalidates(h.DeleteDocument, "documents")).Methods("DELETE")
 
 	return router
 }
@@ -0,0 +1,128 @@
+package email
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	styleBlockRegex = regexp.MustCompile(`(?is)<style[^>]*>(.*?)</style>`)
+	cssCommentRegex = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	cssRuleRegex    = regexp.MustCompile(`(?s)([^{}]+)\{([^{}]*)\}`)
+	startTagRegex   = regexp.MustCompile(`<([a-zA-Z][a-zA-Z0-9]*)((?:\s+[^<>]*?)?)(/?)>`)
+	attributeRegex  = regexp.MustCompile(`(?i)\s(class|id|style)\s*=\s*"([^"]*)"`)
+	selectorRegex   = regexp.MustCompile(`[.#]?[^.#]+`)
+)
+
+// cssRule is a single selector of a style block with its declarations
+type cssRule struct {
+	tag          string
+	id           string
+	classes      []string
+	declarations string
+}
+
+// inlineCSS moves the rules of every <style> block into the style attribute of the elements they match.
+// Only simple selectors are understood: tag, .class, #id and combinations like p.code,
+// which is all the email layouts use. Declarations already inline win over the style block.
+func inlineCSS(html string) string {
+	var rules []cssRule
+	for _, block := range styleBlockRegex.FindAllStringSubmatch(html, -1) {
+		css := cssCommentRegex.ReplaceAllString(block[1], "")
+		for _, match := range cssRuleRegex.FindAllStringSubmatch(css, -1) {
+			declarations := strings.TrimSpace(match[2])
+			for _, selector := range strings.Split(match[1], ",") {
+				if rule, ok := parseSelector(strings.TrimSpace(selector)); ok {
+					rule.declarations = declarations
+					rules = append(rules, rule)
+				}
+			}
+		}
+	}
+	if len(rules) == 0 {
+		return html
+	}
+	html = styleBlockRegex.ReplaceAllString(html, "")
+
+	return startTagRegex.ReplaceAllStringFunc(html, func(tag string) string {
+		parts := startTagRegex.FindStringSubmatch(tag)
+		name, attributes, selfClosing := strings.ToLower(parts[1]), parts[2], parts[3]
+
+		var id, style string
+		var classes []string
+		for _, attribute := range attributeRegex.FindAllStringSubmatch(attributes, -1) {
+			switch strings.ToLower(attribute[1]) {
+			case "id":
+				id = attribute[2]
+			case "class":
+				classes = strings.Fields(attribute[2])
+			case "style":
+				style = attribute[2]
+			}
+		}
+
+		var declarations []string
+		for _, rule := range rules {
+			if rule.matches(name, id, classes) {
+				declarations = append(declarations, strings.TrimSuffix(rule.declarations, ";"))
+			}
+		}
+		if len(declarations) == 0 {
+			return tag
+		}
+		if style != "" {
+			declarations = append(declarations, strings.TrimSuffix(style, ";"))
+		}
+
+		attributes = attributeRegex.ReplaceAllStringFunc(attributes, func(attribute string) string {
+			if strings.EqualFold(attributeRegex.FindStringSubmatch(attribute)[1], "style") {
+				return ""
+			}
+			return attribute
+		})
+		return "<" + parts[1] + attributes + ` style="` + strings.Join(declarations, "; ") + `"` + selfClosing + ">"
+	})
+}
+
+// parseSelector understands tag, .class, #id and their combinations. Anything else is skipped.
+func parseSelector(selector string) (cssRule, bool) {
+	if selector == "" || strings.ContainsAny(selector, " >+~:[*") {
+		return cssRule{}, false
+	}
+
+	var rule cssRule
+	for _, part := range selectorRegex.FindAllString(selector, -1) {
+		switch part[0] {
+		case '.':
+			rule.classes = append(rule.classes, part[1:])
+		case '#':
+			rule.id = part[1:]
+		default:
+			rule.tag = strings.ToLower(part)
+		}
+	}
+	return rule, true
+}
+
+// matches checks if an element with the given tag, id and classes is selected by the rule
+func (rule cssRule) matches(tag, id string, classes []string) bool {
+	if rule.tag != "" && rule.tag != tag {
+		return false
+	}
+	if rule.id != "" && rule.id != id {
+		return false
+	}
+	for _, class := range rule.classes {
+		found := false
+		for _, elementClass := range classes {
+			if elementClass == class {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package email
+
+import "testing"
+
+func TestInlineCSS(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"no style block", `<p class="code">1234</p>`, `<p class="code">1234</p>`},
+		{"tag", `<style>p { color: red; }</style><p>Hi</p>`, `<p style="color: red">Hi</p>`},
+		{"class", `<style>.code { font-weight: bold }</style><p class="big code">1234</p><p>Hi</p>`,
+			`<p class="big code" style="font-weight: bold">1234</p><p>Hi</p>`},
+		{"id", `<style>#footer { color: grey }</style><div id="footer"></div><div id="header"></div>`,
+			`<div id="footer" style="color: grey"></div><div id="header"></div>`},
+		{"tag and class", `<style>p.code { margin: 0 }</style><p class="code"></p><span class="code"></span>`,
+			`<p class="code" style="margin: 0"></p><span class="code"></span>`},
+		{"selector list", `<style>h1, h2 { margin: 0 }</style><h1>A</h1><h2>B</h2>`,
+			`<h1 style="margin: 0">A</h1><h2 style="margin: 0">B</h2>`},
+		{"rules apply in order", `<style>p { color: red } .code { color: blue }</style><p class="code"></p>`,
+			`<p class="code" style="color: red; color: blue"></p>`},
+		{"inline style wins", `<style>p { color: red }</style><p style="color: blue;">Hi</p>`,
+			`<p style="color: red; color: blue">Hi</p>`},
+		{"self closing", `<style>img { border: 0 }</style><img src="logo.png"/>`,
+			`<img src="logo.png" style="border: 0"/>`},
+		{"comments", `<style>/* p { color: red } */ a { color: blue }</style><p></p><a href="#">Go</a>`,
+			`<p></p><a href="#" style="color: blue">Go</a>`},
+		{"complex selectors are skipped", `<style>div p { color: red } .code { margin: 0 }</style><div><p></p></div>`,
+			`<div><p></p></div>`},
+		{"only complex selectors", `<style>a:hover { color: blue }</style><a href="#">Go</a>`,
+			`<style>a:hover { color: blue }</style><a href="#">Go</a>`},
+		{"uppercase tags", `<style>P { color: red }</style><P>Hi</P>`, `<P style="color: red">Hi</P>`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := inlineCSS(test.html); got != test.want {
+				t.Errorf("inlineCSS() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package email
+
+import (
+	"bookateriago/config"
+	"bookateriago/i18n"
+	"bookateriago/log"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Attachment is a file sent along with a message
+type Attachment struct {
+	FileName    string
+	ContentType string
+	Content     []byte
+}
+
+// Message is a single email. Text and HTML are alternative versions of the same body.
+type Message struct {
+	To          string
+	ToName      string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+	// Template is the template the body was rendered from, so failed emails can be told apart without their
+	// bodies, which hold codes and links meant for the recipient only
+	Template string
+}
+
+// Mailer is implemented by everything that can deliver emails
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// New builds the mailer configured by email.driver: "sendgrid", "smtp", "file" or "memory".
+// SendGrid is used if nothing is set, so existing deployments keep working.
+//
+//	sendgrid: email.key
+//	smtp: email.smtp.host, email.smtp.port, email.smtp.username and email.smtp.password
+//	file: email.dir, where every message is written as an .eml file. For development
+//	memory: messages are only kept in memory. For tests
+//
+// Messages are sent from email.from, named email.fromName.
+func New(settings config.EmailConfig) Mailer {
+	from, fromName := settings.From, settings.FromName
+
+	switch settings.Driver {
+	case "smtp":
+		return &SMTPMailer{
+			Host:     settings.SMTP.Host,
+			Port:     settings.SMTP.Port,
+			Username: settings.SMTP.Username,
+			Password: settings.SMTP.Password,
+			From:     from,
+			FromName: fromName,
+		}
+	case "file":
+		return &FileMailer{Dir: settings.Dir, From: from, FromName: fromName}
+	case "memory":
+		return &MemoryMailer{}
+	default:
+		return &SendGridMailer{Key: settings.Key, From: from, FromName: fromName}
+	}
+}
+
+// Check tells if mailer looks able to send, without sending anything: SendGrid has a key, the SMTP server
+// accepts connections and the file mailer's directory isn't something else. It is for the readiness probe.
+func Check(ctx context.Context, mailer Mailer) error {
+	switch m := mailer.(type) {
+	case *SendGridMailer:
+		if m.Key == "" {
+			return errors.New("email: no SendGrid key")
+		}
+	case *SMTPMailer:
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.Host, strconv.Itoa(m.Port)))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case *FileMailer:
+		// A missing directory is created on the first message
+		info, err := os.Stat(m.Dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err == nil && !info.IsDir() {
+			return fmt.Errorf("email: %s is not a directory", m.Dir)
+		}
+	case nil:
+		return errors.New("email: no mailer")
+	}
+	return nil
+}
+
+// SendEmailNoAttachment is for sending emails with no attachments, like OTP, password reset.
+// template is the name of the template in email/templates without the extension, e.g. "token".
+// The email is written in language, and the subject is looked up as email.<template>.subject in the i18n catalog.
+// The email is queued and sent by the worker, so a nil error means it is safely queued, not delivered.
+func (q *Queue) SendEmailNoAttachment(toMail, language string, data interface{}, template string) error {
+	textBody, htmlBody, err := render(template, language, data)
+	if err != nil {
+		return err
+	}
+
+	return q.Enqueue(context.Background(), Message{
+		To:       toMail,
+		Subject:  i18n.T(language, "email."+template+".subject"),
+		Text:     textBody,
+		HTML:     htmlBody,
+		Template: template,
+	})
+}
+
+// SendEmailWithAttachment for attaching the file at filePath to an email. Queued like SendEmailNoAttachment.
+func (q *Queue) SendEmailWithAttachment(toMail, language, filePath, template string, data interface{}) error {
+	fileBytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	textBody, htmlBody, err := render(template, language, data)
+	if err != nil {
+		return err
+	}
+
+	return q.Enqueue(context.Background(), Message{
+		To:       toMail,
+		Subject:  i18n.T(language, "email."+template+".subject"),
+		Text:     textBody,
+		HTML:     htmlBody,
+		Template: template,
+		Attachments: []Attachment{{
+			FileName:    filepath.Base(filePath),
+			ContentType: http.DetectContentType(fileBytes),
+			Content:     fileBytes,
+		}},
+	})
+}
+
+// logSend logs failed deliveries, so every mailer reports them the same way
+func logSend(err error) error {
+	log.ErrorHandler(err)
+	return err
+}
@@ -0,0 +1,264 @@
+package email
+
+import (
+	"bookateriago/config"
+	"bookateriago/log"
+	"bookateriago/metrics"
+	"bookateriago/tracing"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/label"
+)
+
+// Redis keys of the queue. Messages wait in queueKey, are leased in leaseKey (scored by when the lease runs
+// out) while a worker sends them, wait in retryKey (scored by when to try again) after a failure, and end up
+// in deadKey when out of attempts.
+const (
+	queueKey = "email_queue"
+	leaseKey = "email_leases"
+	retryKey = "email_retry"
+	deadKey  = "email_dead"
+)
+
+// lease is how long a worker has to send a message. A message still leased after that is taken to belong
+// to a worker that died, and goes back in the queue: it can be sent twice that way, which beats losing it.
+const lease = 10 * time.Minute
+
+// pollInterval is how long an idle worker waits before looking at the queue again
+const pollInterval = time.Second
+
+// take moves the oldest queued message to the leases, expiring at ARGV[1], in one step so a worker dying in
+// between can't lose it
+var take = redis.NewScript(`
+local message = redis.call("RPOP", KEYS[1])
+if message then
+	redis.call("ZADD", KEYS[2], ARGV[1], message)
+end
+return message
+`)
+
+// moveDue moves the members of the sorted set KEYS[1] scored ARGV[1] or less to the queue KEYS[2]
+var moveDue = redis.NewScript(`
+local due = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1])
+for _, message in ipairs(due) do
+	redis.call("ZREM", KEYS[1], message)
+	redis.call("LPUSH", KEYS[2], message)
+end
+return #due
+`)
+
+// ErrNotQueued is returned when a dead message to requeue doesn't exist
+var ErrNotQueued = errors.New("email: message not found")
+
+// Queue holds the messages waiting to be sent in Redis, and sends them with its mailer
+type Queue struct {
+	client *redis.Client
+	mailer Mailer
+}
+
+// NewQueue keeps the queue in client and sends its messages with mailer
+func NewQueue(client *redis.Client, mailer Mailer) *Queue {
+	return &Queue{client: client, mailer: mailer}
+}
+
+// QueuedMessage is a message waiting in the queue, with the history of its delivery attempts
+type QueuedMessage struct {
+	ID         string    `json:"id"`
+	Message    Message   `json:"message"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"last_error,omitempty"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	FailedAt   time.Time `json:"failed_at,omitempty"`
+}
+
+// Enqueue stores the message in redis for the worker to send. Once this returns nil the message is durable.
+func (q *Queue) Enqueue(ctx context.Context, message Message) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	queued, err := json.Marshal(QueuedMessage{
+		ID:         hex.EncodeToString(id),
+		Message:    message,
+		EnqueuedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	return q.client.LPush(ctx, queueKey, queued).Err()
+}
+
+// StartWorker sends queued messages with the mailer of the queue until ctx is cancelled. Any number of workers
+// can share the queue, on as many servers. Failed messages are retried with exponential backoff, up to
+// email.maxAttempts times (default 5), starting at email.retryBackoff (default 30s). After that they are
+// moved to the dead letter list.
+func (q *Queue) StartWorker(ctx context.Context) {
+	for ctx.Err() == nil {
+		q.moveDueMessages(ctx, retryKey)
+		// Messages whose worker died while sending them
+		q.moveDueMessages(ctx, leaseKey)
+
+		raw, err := take.Run(ctx, q.client, []string{queueKey, leaseKey},
+			time.Now().Add(lease).Unix()).Text()
+		if errors.Is(err, redis.Nil) {
+			sleep(ctx, pollInterval)
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.ErrorHandler(err)
+				sleep(ctx, time.Second)
+			}
+			continue
+		}
+
+		q.process(ctx, raw)
+		// Even when ctx was just cancelled, the message is done with
+		q.client.ZRem(context.Background(), leaseKey, raw)
+	}
+}
+
+// sleep waits for d, or until ctx is cancelled
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// process sends one message, scheduling a retry or burying it when that fails
+func (q *Queue) process(ctx context.Context, raw string) {
+	var queued QueuedMessage
+	if err := json.Unmarshal([]byte(raw), &queued); err != nil {
+		log.ErrorHandler(err)
+		return
+	}
+
+	sendCtx, span := tracing.Start(ctx, "email send",
+		label.String("email.driver", config.Get().Email.Driver), label.Int("email.attempt", queued.Attempts+1))
+	err := q.mailer.Send(sendCtx, queued.Message)
+	tracing.End(span, err)
+	if err == nil {
+		metrics.EmailSent()
+		return
+	}
+
+	queued.Attempts++
+	queued.LastError = err.Error()
+	queued.FailedAt = time.Now()
+	updated, _ := json.Marshal(queued)
+
+	dead := queued.Attempts >= maxAttempts()
+	metrics.EmailFailed(dead)
+	if dead {
+		err = q.client.HSet(ctx, deadKey, queued.ID, updated).Err()
+		log.ErrorHandler(err)
+		return
+	}
+
+	retryAt := time.Now().Add(backoff(queued.Attempts))
+	err = q.client.ZAdd(ctx, retryKey, &redis.Z{Score: float64(retryAt.Unix()), Member: updated}).Err()
+	log.ErrorHandler(err)
+}
+
+// moveDueMessages moves the messages of key, retryKey or leaseKey, whose backoff or lease is over back to
+// the queue. The script runs as a whole, so two workers can't both requeue a message.
+func (q *Queue) moveDueMessages(ctx context.Context, key string) {
+	err := moveDue.Run(ctx, q.client, []string{key, queueKey}, time.Now().Unix()).Err()
+	if err != nil && ctx.Err() == nil {
+		log.ErrorHandler(err)
+	}
+}
+
+// backoff is how long to wait before the next attempt, doubling every time up to an hour
+func backoff(attempts int) time.Duration {
+	wait := config.Get().Email.RetryBackoff
+	for i := 1; i < attempts && wait < time.Hour; i++ {
+		wait *= 2
+	}
+	if wait > time.Hour {
+		wait = time.Hour
+	}
+	return wait
+}
+
+// maxAttempts is how many times a message is tried before it is dead lettered
+func maxAttempts() int {
+	return config.Get().Email.MaxAttempts
+}
+
+// DeadMessages lists the messages that ran out of attempts, most recent failure first
+func (q *Queue) DeadMessages(ctx context.Context) ([]QueuedMessage, error) {
+	all, err := q.client.HGetAll(ctx, deadKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]QueuedMessage, 0, len(all))
+	for _, raw := range all {
+		var queued QueuedMessage
+		if err = json.Unmarshal([]byte(raw), &queued); err != nil {
+			log.ErrorHandler(err)
+			continue
+		}
+		messages = append(messages, queued)
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].FailedAt.After(messages[j].FailedAt)
+	})
+	return messages, nil
+}
+
+// Requeue puts a dead message back in the queue with a fresh set of attempts
+func (q *Queue) Requeue(ctx context.Context, id string) error {
+	raw, err := q.client.HGet(ctx, deadKey, id).Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrNotQueued
+	}
+	if err != nil {
+		return err
+	}
+
+	var queued QueuedMessage
+	if err = json.Unmarshal([]byte(raw), &queued); err != nil {
+		return err
+	}
+	queued.Attempts = 0
+	updated, err := json.Marshal(queued)
+	if err != nil {
+		return err
+	}
+
+	// Only whoever removes it gets to requeue it, so it can't be queued twice
+	removed, err := q.client.HDel(ctx, deadKey, id).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrNotQueued
+	}
+	return q.client.LPush(ctx, queueKey, updated).Err()
+}
+
+// Discard deletes a dead message for good
+func (q *Queue) Discard(ctx context.Context, id string) error {
+	removed, err := q.client.HDel(ctx, deadKey, id).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrNotQueued
+	}
+	return nil
+}
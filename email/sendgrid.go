@@ -0,0 +1,43 @@
+package email
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// SendGridMailer delivers through the SendGrid API
+type SendGridMailer struct {
+	Key      string
+	From     string
+	FromName string
+}
+
+// Send hands the message over to SendGrid. Anything but a 2xx response is an error.
+func (s *SendGridMailer) Send(_ context.Context, message Message) error {
+	from := mail.NewEmail(s.FromName, s.From)
+	to := mail.NewEmail(message.ToName, message.To)
+	content := mail.NewSingleEmail(from, message.Subject, to, message.Text, message.HTML)
+
+	for _, attachment := range message.Attachments {
+		a := mail.NewAttachment()
+		a.SetContent(base64.StdEncoding.EncodeToString(attachment.Content))
+		a.SetFilename(attachment.FileName)
+		a.SetType(attachment.ContentType)
+		a.SetDisposition("attachment")
+		content.AddAttachment(a)
+	}
+
+	client := sendgrid.NewSendClient(s.Key)
+	response, err := client.Send(content)
+	if err != nil {
+		return logSend(err)
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return logSend(fmt.Errorf("sendgrid: status %d: %s", response.StatusCode, response.Body))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileMailer writes every message into Dir as an .eml file instead of sending it.
+// Any mail client can open them, which makes it handy for development.
+type FileMailer struct {
+	Dir      string
+	From     string
+	FromName string
+}
+
+// Send writes the message to a file named after the time and the recipient
+func (f *FileMailer) Send(_ context.Context, message Message) error {
+	body, err := message.bytes(f.From, f.FromName)
+	if err != nil {
+		return logSend(err)
+	}
+	if err = os.MkdirAll(f.Dir, 0755); err != nil {
+		return logSend(err)
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"),
+		strings.NewReplacer("@", "_at_", "/", "_").Replace(message.To))
+	return logSend(os.WriteFile(filepath.Join(f.Dir, name), body, 0644))
+}
+
+// MemoryMailer keeps every message sent in memory. Meant for tests.
+type MemoryMailer struct {
+	mutex    sync.Mutex
+	messages []Message
+}
+
+// Send stores the message
+func (m *MemoryMailer) Send(_ context.Context, message Message) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// Messages returns everything sent so far
+func (m *MemoryMailer) Messages() []Message {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Reset forgets every message sent so far
+func (m *MemoryMailer) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.messages = nil
+}
@@ -0,0 +1,33 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+)
+
+// SMTPMailer delivers to a plain SMTP server. STARTTLS is used when the server supports it.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	FromName string
+}
+
+// Send delivers the message. Authentication is skipped when no username is configured.
+func (s *SMTPMailer) Send(_ context.Context, message Message) error {
+	body, err := message.bytes(s.From, s.FromName)
+	if err != nil {
+		return logSend(err)
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	address := fmt.Sprintf("%s:%d", s.Host, s.Port)
+	return logSend(smtp.SendMail(address, auth, s.From, []string{message.To}, body))
+}
@@ -0,0 +1,59 @@
+package email
+
+import (
+	"bookateriago/i18n"
+	"bytes"
+	"embed"
+	htmlTemplate "html/template"
+	"io/fs"
+	textTemplate "text/template"
+)
+
+// templateFS holds the email templates, built into the binary so they're found wherever it runs from.
+// Every email has a .txt and a .html template defining "content", which is rendered inside
+// the "base" layout of the same type in base.txt and base.html.
+// Translations sit next to them with the language before the extension, e.g. token.fr.html.
+//
+//go:embed templates/*.txt templates/*.html
+var templateFS embed.FS
+
+// render executes both variants of the named template in the language with data, e.g. render("token", "fr", data).
+// Every language in the fallback chain of language is tried, ending with English.
+// CSS in the HTML layout is inlined, since most mail clients ignore <style> blocks.
+func render(name, language string, data interface{}) (string, string, error) {
+	text, err := textTemplate.ParseFS(templateFS,
+		localized("base", language, "txt"), localized(name, language, "txt"))
+	if err != nil {
+		return "", "", err
+	}
+	var textBody bytes.Buffer
+	if err = text.ExecuteTemplate(&textBody, "base", data); err != nil {
+		return "", "", err
+	}
+
+	html, err := htmlTemplate.ParseFS(templateFS,
+		localized("base", language, "html"), localized(name, language, "html"))
+	if err != nil {
+		return "", "", err
+	}
+	var htmlBody bytes.Buffer
+	if err = html.ExecuteTemplate(&htmlBody, "base", data); err != nil {
+		return "", "", err
+	}
+
+	return textBody.String(), inlineCSS(htmlBody.String()), nil
+}
+
+// localized finds the path of the best translation of a template. English has no language suffix.
+func localized(name, language, extension string) string {
+	for _, candidate := range i18n.Fallbacks(language) {
+		path := "templates/" + name + "." + candidate + "." + extension
+		if candidate == i18n.Fallback {
+			path = "templates/" + name + "." + extension
+		}
+		if _, err := fs.Stat(templateFS, path); err == nil {
+			return path
+		}
+	}
+	return "templates/" + name + "." + extension
+}
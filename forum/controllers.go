@@ -2,137 +2,107 @@ package forum
 
 import (
 	"bookateriago/account"
+	"bookateriago/audit"
+	"bookateriago/binding"
 	"bookateriago/core"
 	"bookateriago/log"
-	"crypto/rand"
+	"bookateriago/pagination"
+	"bookateriago/slugs"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
-	"math/big"
 	"net/http"
 	"regexp"
 	"strings"
 )
 
-var (
-	answerUpVotes   []answerUpvote
-	oneAUpVote      answerUpvote
-	answers         []answer
-	oneAnswer       answer
-	db              = InitDatabase()
-	oneQuestion     question
-	questions       []question
-	oneQUpVote      questionUpVote
-	questionUpVotes []questionUpVote
-	//questionTags    []questionTag
-	user account.User
-)
+// handler serves the forum routes from the database
+type handler struct {
+	db       *gorm.DB
+	sessions *core.Sessions
+}
 
 // GetQuestion responds with a oneQuestion if the given slug exists
-func GetQuestion(w http.ResponseWriter, r *http.Request) {
+func (h *handler) GetQuestion(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	slugToFind := params["slug"]
 
-	if !XExists(slugToFind, "question") {
+	if !h.XExists(r.Context(), slugToFind, "question") {
 		// Checks if oneQuestion exists
 		// If it doesn't return message accordingly
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
-	db.Preload(clause.Associations).First(&oneQuestion, slugToFind)
+	var oneQuestion question
+	h.db.WithContext(r.Context()).Preload(clause.Associations).First(&oneQuestion, slugToFind)
 	err := json.NewEncoder(w).Encode(oneQuestion)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	log.ErrorContext(r.Context(), err)
 	return
 }
 
-// GetQuestions gets a list of all questions in the database
-func GetQuestions(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	db.Preload(clause.Associations).Find(&questions)
-	err := json.NewEncoder(w).Encode(questions)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
-	return
+// GetQuestions gets a page of all questions in the database
+func (h *handler) GetQuestions(w http.ResponseWriter, r *http.Request) {
+	var questions []question
+	pagination.List(w, r, h.db.WithContext(r.Context()).Model(&question{}).Preload(clause.Associations), &questions)
 }
 
 // PostQuestion is the function that handles creation of a new questions
-func PostQuestion(w http.ResponseWriter, r *http.Request) {
+func (h *handler) PostQuestion(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	err := json.NewDecoder(r.Body).Decode(&oneQuestion)
-	log.ErrorHandler(err)
-
-	oneQuestion.Title = strings.Join(strings.Fields(oneQuestion.Title), " ")
-
-	isValid := validator([]string{oneQuestion.Title})
-
-	for _, tag := range oneQuestion.QuestionTags {
-		if tag.Name == "" {
-			isValid = false
-		}
-	}
-
-	if !isValid {
-		w.WriteHeader(http.StatusBadRequest)
-		err = json.NewEncoder(w).Encode(core.FourHundred)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 400)
+	_, email := h.sessions.GetTokenEmail(r)
+	if email == "" {
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
-	_, email := core.GetTokenEmail(r)
-	if email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err = json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+	var body questionRequest
+	if !binding.JSON(w, r, &body) {
 		return
 	}
 
+	var user account.User
 	// get user
-	db.Find(&user, "email = ?", strings.ToLower(email))
-	oneQuestion.User = user
-
-	// get random string
-	otp, err := rand.Int(rand.Reader, big.NewInt(999))
+	h.db.WithContext(r.Context()).Find(&user, "email = ?", strings.ToLower(email))
+	oneQuestion := question{
+		Title:        strings.Title(strings.Join(strings.Fields(body.Title), " ")),
+		Description:  body.Description,
+		QuestionTags: questionTags(body.Tags),
+		User:         user,
+	}
+
+	// Save the oneQuestion under a slug, made from the title, that no other question has
+	err := slugs.Create(r.Context(), h.db, "questions", oneQuestion.Title, func(tx *gorm.DB, slug string) error {
+		oneQuestion.Slug = slug
+		if err := tx.Create(&oneQuestion).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Create, EntityType: "question", EntityID: oneQuestion.ID, After: oneQuestion,
+		})
+	})
 	if err != nil {
-		fmt.Println(err)
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
 	}
 
-	// generate slug from title
-	reg, _ := regexp.Compile("[^a-zA-Z0-9-]+")
-	oneQuestion.Slug = strings.Join(strings.Fields(oneQuestion.Title), "-")
-	oneQuestion.Slug = strings.ToLower(strings.ReplaceAll(oneQuestion.Slug, " ", "-"))
-	oneQuestion.Slug = reg.ReplaceAllString(oneQuestion.Slug, "") + "-" + otp.String()
-
-	oneQuestion.Title = strings.Title(oneQuestion.Title)
-
-	db.Create(&oneQuestion)
 	err = json.NewEncoder(w).Encode(oneQuestion)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	log.ErrorContext(r.Context(), err)
 	return
 }
 
 // UpdateQuestion adjusts data of already created questions
-func UpdateQuestion(w http.ResponseWriter, r *http.Request) {
+func (h *handler) UpdateQuestion(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Check if user is logged in
-	_, email := core.GetTokenEmail(r)
+	_, email := h.sessions.GetTokenEmail(r)
 	if email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
@@ -141,64 +111,64 @@ func UpdateQuestion(w http.ResponseWriter, r *http.Request) {
 	slug := params["slug"]
 
 	// Checks if oneQuestion exists
-	if !XExists(slug, "question") {
+	if !h.XExists(r.Context(), slug, "question") {
 		// If it doesn't return message accordingly
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
-	db.Where("slug = ?", slug).Find(&oneQuestion)
+	var oneQuestion question
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Where("slug = ?", slug).Find(&oneQuestion)
 
 	// Check if logged in user created the oneQuestion
 	if email != oneQuestion.User.Email {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOThree)
 		return
 	}
 
-	// Update the oneQuestion
-	err := json.NewDecoder(r.Body).Decode(&oneQuestion)
-	log.ErrorHandler(err)
-
-	isValid := validator([]string{oneQuestion.Title})
-
-	for _, tag := range oneQuestion.QuestionTags {
-		if tag.Name == "" {
-			isValid = false
-		}
+	// Update the oneQuestion, only the details it asks, not who asked it or where it lives
+	var body questionUpdate
+	if !binding.JSON(w, r, &body) {
+		return
+	}
+	before := audit.Snapshot(oneQuestion)
+	if body.Title != nil {
+		oneQuestion.Title = strings.Title(strings.Join(strings.Fields(*body.Title), " "))
+	}
+	if body.Description != nil {
+		oneQuestion.Description = *body.Description
 	}
+	oneQuestion.QuestionTags = append(oneQuestion.QuestionTags, questionTags(body.Tags)...)
 
-	if !isValid {
-		w.WriteHeader(http.StatusBadRequest)
-		err = json.NewEncoder(w).Encode(core.FourHundred)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 400)
+	// A new title gets a new slug, and links to the old one are redirected
+	err := slugs.Update(r.Context(), h.db, "questions", oneQuestion.ID, oneQuestion.Slug, oneQuestion.Title, func(tx *gorm.DB, slug string) error {
+		oneQuestion.Slug = slug
+		if err := tx.Save(&oneQuestion).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Update, EntityType: "question", EntityID: oneQuestion.ID,
+			Before: before, After: oneQuestion,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
 		return
 	}
 
-	db.Save(&oneQuestion)
-
 	// Return the oneQuestion details
 	err = json.NewEncoder(w).Encode(oneQuestion)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	log.ErrorContext(r.Context(), err)
 	return
 }
 
 // DeleteQuestion removes an already created oneQuestion
-func DeleteQuestion(w http.ResponseWriter, r *http.Request) {
+func (h *handler) DeleteQuestion(w http.ResponseWriter, r *http.Request) {
 	// Check if user is logged in
-	_, email := core.GetTokenEmail(r)
+	_, email := h.sessions.GetTokenEmail(r)
 	if email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
@@ -206,122 +176,142 @@ func DeleteQuestion(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	slug := params["slug"]
 
-	if !XExists(slug, "question") {
+	if !h.XExists(r.Context(), slug, "question") {
 		// Checks if oneQuestion exists
 		// If it doesn't return message accordingly
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
+	var oneQuestion question
 	// Check if logged in user has permission to delete oneQuestion
-	db.Preload(clause.Associations).Where("slug = ?", slug).Find(&oneQuestion)
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Where("slug = ?", slug).Find(&oneQuestion)
 	if email != oneQuestion.User.Email {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOThree)
+		return
+	}
+	err := h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("slug = ?", slug).Delete(&question{}).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Delete, EntityType: "question", EntityID: oneQuestion.ID, Before: oneQuestion,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
 		return
 	}
-	db.Where("slug = ?", slug).Delete(&oneQuestion)
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// GetQuestionUpVotes gets all the oneQuestion up votes
-func GetQuestionUpVotes(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// GetQuestionUpVotes gets a page of the oneQuestion up votes
+func (h *handler) GetQuestionUpVotes(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	slug := params["slug"]
 
 	var problem question
-	db.Where("slug = ?", slug).Find(&problem)
+	h.db.WithContext(r.Context()).Where("slug = ?", slug).Find(&problem)
 
-	db.Preload(clause.Associations).Where("question_id = ?", problem.ID).Find(&questionUpVotes)
-	err := json.NewEncoder(w).Encode(questionUpVotes)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
-	return
+	var questionUpVotes []questionUpVote
+	query := h.db.WithContext(r.Context()).Model(&questionUpVote{}).Preload(clause.Associations).Where("question_id = ?", problem.ID)
+	pagination.List(w, r, query, &questionUpVotes)
 }
 
 // PostQuestionUpVote creates a new upvote for a particular oneQuestion
-func PostQuestionUpVote(w http.ResponseWriter, r *http.Request) {
+func (h *handler) PostQuestionUpVote(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Check if user is logged in
-	_, email := core.GetTokenEmail(r)
+	_, email := h.sessions.GetTokenEmail(r)
 	if email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 	params := mux.Vars(r)
 	slug := params["slug"]
 
-	if !XExists(slug, "question") {
+	if !h.XExists(r.Context(), slug, "question") {
 		// If it doesn't return message accordingly
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
-	db.Where("slug = ?", slug).First(&oneQuestion)
-	db.Find(&user, "email = ?", strings.ToLower(email))
+	var (
+		oneQuestion question
+		user        account.User
+	)
+	h.db.WithContext(r.Context()).Where("slug = ?", slug).First(&oneQuestion)
+	h.db.WithContext(r.Context()).Find(&user, "email = ?", strings.ToLower(email))
 
-	err := db.Where("user_id = ?", user.ID).Error
+	err := h.db.WithContext(r.Context()).Where("user_id = ?", user.ID).Error
 
 	if !errors.Is(err, gorm.ErrRecordNotFound) {
-		w.WriteHeader(http.StatusBadRequest)
-		err = json.NewEncoder(w).Encode(core.FourHundred)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 400)
+		core.WriteProblem(w, r, core.FourHundred)
 		return
 	}
 
-	oneQUpVote = questionUpVote{
+	oneQUpVote := questionUpVote{
 		Question: oneQuestion,
 		User:     user,
 	}
-	db.Create(&oneQUpVote)
-	log.AccessHandler(r, 200)
+	err = h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&oneQUpVote).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Create, EntityType: "question_upvote", EntityID: oneQUpVote.ID, After: oneQUpVote,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+	}
 	return
 }
 
 // DeleteQuestionUpvote removes an upvote from a oneQuestion
-func DeleteQuestionUpvote(w http.ResponseWriter, r *http.Request) {
+func (h *handler) DeleteQuestionUpvote(w http.ResponseWriter, r *http.Request) {
 	// Check if user is logged in
-	_, email := core.GetTokenEmail(r)
+	_, email := h.sessions.GetTokenEmail(r)
 	if email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
 	params := mux.Vars(r)
 	slug := params["slug"]
 
-	db.Find(&user, "email = ?", strings.ToLower(email))
-	db.Where("questionupvote_question_slug = ?", slug).Where(
+	var (
+		oneQUpVote questionUpVote
+		user       account.User
+	)
+	h.db.WithContext(r.Context()).Find(&user, "email = ?", strings.ToLower(email))
+	h.db.WithContext(r.Context()).Where("questionupvote_question_slug = ?", slug).Where(
 		"questionupvote_user_id = ?", user.ID).Find(&oneQUpVote)
 
 	// Check if logged in user posted the upvote. If not, no permission to delete.
 	if email != oneQUpVote.User.Email {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOThree)
 		return
 	}
 
-	db.Where("questionupvote_question_slug = ?", slug).Where(
-		"questionupvote_user_id = ?", user.ID).Delete(&oneQUpVote)
+	err := h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("questionupvote_question_slug = ?", slug).Where(
+			"questionupvote_user_id = ?", user.ID).Delete(&oneQUpVote).Error
+		if err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Delete, EntityType: "question_upvote", EntityID: oneQUpVote.ID, Before: oneQUpVote,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 	return
 }
@@ -329,62 +319,54 @@ func DeleteQuestionUpvote(w http.ResponseWriter, r *http.Request) {
 // Answers and oneAnswer up votes
 
 // GetAnswer responds with an oneAnswer bt the slug given
-func GetAnswer(w http.ResponseWriter, r *http.Request) {
+func (h *handler) GetAnswer(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	slug := params["slug"]
 	questionSlug := params["questionSlug"]
 
-	if !(XExists(questionSlug, "question") && XExists(slug, "answer")) {
+	if !(h.XExists(r.Context(), questionSlug, "question") && h.XExists(r.Context(), slug, "answer")) {
 		// Checks if oneAnswer exists
 		// If it doesn't return message accordingly
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
-	db.Preload(clause.Associations).Find(&oneQuestion, "slug = ?", questionSlug)
-	db.Preload(clause.Associations).Where("slug = ?", slug).Where("question_id = ?", oneQuestion.ID).First(&oneAnswer)
+	var (
+		oneQuestion question
+		oneAnswer   answer
+	)
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Find(&oneQuestion, "slug = ?", questionSlug)
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Where("slug = ?", slug).Where("question_id = ?", oneQuestion.ID).First(&oneAnswer)
 	err := json.NewEncoder(w).Encode(oneAnswer)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	log.ErrorContext(r.Context(), err)
 	return
 }
 
-// GetAnswers responds with all answers on a desired oneQuestion
-func GetAnswers(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// GetAnswers responds with a page of the answers on a desired oneQuestion
+func (h *handler) GetAnswers(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	questionSlug := params["questionSlug"]
 
-	if !XExists(questionSlug, "question") {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+	if !h.XExists(r.Context(), questionSlug, "question") {
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
-	db.Preload(clause.Associations).Find(&oneQuestion, "slug = ?", questionSlug)
+	var oneQuestion question
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Find(&oneQuestion, "slug = ?", questionSlug)
 
-	db.Preload(clause.Associations).Find(&answers, "question_id = ?", oneQuestion.ID)
-	err := json.NewEncoder(w).Encode(answers)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
-	return
+	var answers []answer
+	query := h.db.WithContext(r.Context()).Model(&answer{}).Preload(clause.Associations).Where("question_id = ?", oneQuestion.ID)
+	pagination.List(w, r, query, &answers)
 }
 
 // PostAnswer for creating a new oneAnswer
-func PostAnswer(w http.ResponseWriter, r *http.Request) {
+func (h *handler) PostAnswer(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Check if user is logged in
-	_, email := core.GetTokenEmail(r)
+	_, email := h.sessions.GetTokenEmail(r)
 	if email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
@@ -392,50 +374,57 @@ func PostAnswer(w http.ResponseWriter, r *http.Request) {
 	questionSlug := params["questionSlug"]
 
 	// Check if oneQuestion exists
-	if !XExists(questionSlug, "question") {
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+	if !h.XExists(r.Context(), questionSlug, "question") {
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
-	db.Find(&oneQuestion, "slug = ?", questionSlug)
-
-	err := json.NewDecoder(r.Body).Decode(&oneAnswer)
-	log.ErrorHandler(err)
-
-	oneAnswer.Question = oneQuestion
+	var body answerRequest
+	if !binding.JSON(w, r, &body) {
+		return
+	}
 
-	db.Find(&user, "email = ?", strings.ToLower(email))
-	oneAnswer.User = user
+	var (
+		oneQuestion question
+		user        account.User
+	)
+	h.db.WithContext(r.Context()).Find(&oneQuestion, "slug = ?", questionSlug)
+	h.db.WithContext(r.Context()).Find(&user, "email = ?", strings.ToLower(email))
+	oneAnswer := answer{
+		Question: oneQuestion,
+		Response: body.Response,
+		User:     user,
+	}
 
-	// generate random code
-	code, err := rand.Int(rand.Reader, big.NewInt(999))
+	// Answers are numbered after the question they answer
+	err := slugs.Create(r.Context(), h.db, "answers", oneQuestion.Slug+"-answer", func(tx *gorm.DB, slug string) error {
+		oneAnswer.Slug = slug
+		if err := tx.Create(&oneAnswer).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Create, EntityType: "answer", EntityID: oneAnswer.ID, After: oneAnswer,
+		})
+	})
 	if err != nil {
-		fmt.Println(err)
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
 	}
 
-	// Generate slug
-	oneAnswer.Slug = oneQuestion.Slug + "answer" + code.String()
-
-	db.Preload(clause.Associations).Create(&oneAnswer)
 	err = json.NewEncoder(w).Encode(oneAnswer)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	log.ErrorContext(r.Context(), err)
 	return
 }
 
 // UpdateAnswer endpoint for updating answers
-func UpdateAnswer(w http.ResponseWriter, r *http.Request) {
+func (h *handler) UpdateAnswer(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Check if user is logged in
-	_, email := core.GetTokenEmail(r)
+	_, email := h.sessions.GetTokenEmail(r)
 	if email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
@@ -444,51 +433,60 @@ func UpdateAnswer(w http.ResponseWriter, r *http.Request) {
 	questionSlug := params["questionSlug"]
 
 	// Checks if oneAnswer exists
-	if !(XExists(questionSlug, "question") && XExists(slug, "answer")) {
+	if !(h.XExists(r.Context(), questionSlug, "question") && h.XExists(r.Context(), slug, "answer")) {
 		// If it doesn't return message accordingly
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
-	db.Find(&oneQuestion, "slug = ?", questionSlug).Preload(clause.Associations)
+	var (
+		oneQuestion question
+		oneAnswer   answer
+	)
+	h.db.WithContext(r.Context()).Find(&oneQuestion, "slug = ?", questionSlug).Preload(clause.Associations)
 	// Get oneAnswer
-	db.Preload(clause.Associations).Where("slug = ?", slug).Where("question_id = ?", oneQuestion.ID).Find(&oneAnswer)
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Where("slug = ?", slug).Where("question_id = ?", oneQuestion.ID).Find(&oneAnswer)
 
 	// Check if logged in user has permission to update oneAnswer
 	if email != oneAnswer.User.Email {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOThree)
 		return
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&oneAnswer)
-	log.ErrorHandler(err)
-	db.Find(&user, "email = ?", strings.ToLower(email))
-	oneAnswer.Slug = slug
-	oneAnswer.User = user
-	db.Save(&oneAnswer)
+	// Only the response itself can change
+	var body answerRequest
+	if !binding.JSON(w, r, &body) {
+		return
+	}
+	before := audit.Snapshot(oneAnswer)
+	oneAnswer.Response = body.Response
+	err := h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&oneAnswer).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Update, EntityType: "answer", EntityID: oneAnswer.ID,
+			Before: before, After: oneAnswer,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
 	err = json.NewEncoder(w).Encode(oneAnswer)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
+	log.ErrorContext(r.Context(), err)
 	return
 }
 
 // DeleteAnswer removes a created oneAnswer
-func DeleteAnswer(w http.ResponseWriter, r *http.Request) {
+func (h *handler) DeleteAnswer(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Check if user is logged in
-	_, email := core.GetTokenEmail(r)
+	_, email := h.sessions.GetTokenEmail(r)
 	if email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
@@ -497,71 +495,75 @@ func DeleteAnswer(w http.ResponseWriter, r *http.Request) {
 	questionSlug := params["questionSlug"]
 
 	// Checks if oneQuestion and oneAnswer exists
-	if !(XExists(questionSlug, "question") && XExists(slug, "answer")) {
+	if !(h.XExists(r.Context(), questionSlug, "question") && h.XExists(r.Context(), slug, "answer")) {
 		// If it doesn't return message accordingly
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
+	var (
+		oneQuestion question
+		oneAnswer   answer
+	)
 	// Get oneAnswer
-	db.Find(&oneQuestion, "slug = ?", questionSlug)
-	db.Where("slug = ?", slug).Where("question_id = ?", oneQuestion.ID).Find(&oneAnswer)
+	h.db.WithContext(r.Context()).Find(&oneQuestion, "slug = ?", questionSlug)
+	h.db.WithContext(r.Context()).Preload("User").Where("slug = ?", slug).Where("question_id = ?", oneQuestion.ID).Find(&oneAnswer)
 
 	// Check if logged in user has permission to update oneAnswer
 	if email != oneAnswer.User.Email {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOThree)
 		return
 	}
 
-	db.Where("slug = ?", slug).Where("question_id = ?", oneQuestion.ID).Delete(&oneAnswer)
+	err := h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("slug = ?", slug).Where("question_id = ?", oneQuestion.ID).Delete(&answer{}).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Delete, EntityType: "answer", EntityID: oneAnswer.ID, Before: oneAnswer,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
-	log.AccessHandler(r, 204)
 	return
 }
 
-// GetAnswerUpVotes returns all up votes on a given oneQuestion
-func GetAnswerUpVotes(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// GetAnswerUpVotes returns a page of the up votes on a given oneAnswer
+func (h *handler) GetAnswerUpVotes(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	slug := params["slug"]
 	questionSlug := params["questionSlug"]
 
 	// Checks if oneQuestion and oneAnswer exists
-	if !(XExists(questionSlug, "question") && XExists(slug, "answer")) {
+	if !(h.XExists(r.Context(), questionSlug, "question") && h.XExists(r.Context(), slug, "answer")) {
 		// If it doesn't return message accordingly
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
-	db.Find(&oneQuestion, "slug = ?", questionSlug)
-	db.Find(&oneAnswer, "question_id = ? AND slug = ?", oneQuestion.ID, slug)
+	var (
+		oneQuestion question
+		oneAnswer   answer
+	)
+	h.db.WithContext(r.Context()).Find(&oneQuestion, "slug = ?", questionSlug)
+	h.db.WithContext(r.Context()).Find(&oneAnswer, "question_id = ? AND slug = ?", oneQuestion.ID, slug)
 
-	db.Preload(clause.Associations).Where("answer_id = ?", oneAnswer.ID).Find(&answerUpVotes)
-	err := json.NewEncoder(w).Encode(answerUpVotes)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
-	return
+	var answerUpVotes []answerUpvote
+	query := h.db.WithContext(r.Context()).Model(&answerUpvote{}).Preload(clause.Associations).Where("answer_id = ?", oneAnswer.ID)
+	pagination.List(w, r, query, &answerUpVotes)
 }
 
 // PostAnswerUpVote up votes an oneAnswer
-func PostAnswerUpVote(w http.ResponseWriter, r *http.Request) {
+func (h *handler) PostAnswerUpVote(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Check if user is logged in
-	_, email := core.GetTokenEmail(r)
+	_, email := h.sessions.GetTokenEmail(r)
 	if email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
@@ -570,49 +572,55 @@ func PostAnswerUpVote(w http.ResponseWriter, r *http.Request) {
 	questionSlug := params["questionSlug"]
 
 	// Checks if oneQuestion and oneAnswer exists
-	if !(XExists(questionSlug, "question") && XExists(slug, "answer")) {
+	if !(h.XExists(r.Context(), questionSlug, "question") && h.XExists(r.Context(), slug, "answer")) {
 		// If it doesn't return message accordingly
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
-	db.Find(&oneQuestion, "slug = ?", questionSlug)
-	db.Find(&oneAnswer, "question_id = ? AND slug = ?", oneQuestion.ID, slug)
-	db.Find(&user, "email = ?", strings.ToLower(email))
+	var (
+		oneQuestion question
+		oneAnswer   answer
+		user        account.User
+	)
+	h.db.WithContext(r.Context()).Find(&oneQuestion, "slug = ?", questionSlug)
+	h.db.WithContext(r.Context()).Find(&oneAnswer, "question_id = ? AND slug = ?", oneQuestion.ID, slug)
+	h.db.WithContext(r.Context()).Find(&user, "email = ?", strings.ToLower(email))
 
 	// Check if upvote exists
 	var count int64
-	db.Model(&answerUpvote{}).Where("user_id = ?", user.ID).Count(&count)
+	h.db.WithContext(r.Context()).Model(&answerUpvote{}).Where("user_id = ?", user.ID).Count(&count)
 
 	if count > 0 {
-		w.WriteHeader(http.StatusConflict)
-		err := json.NewEncoder(w).Encode(core.FourONine)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 409)
+		core.WriteProblem(w, r, core.FourONine.WithCode("already_voted"))
 		return
 	}
 
-	oneAUpVote = answerUpvote{
+	oneAUpVote := answerUpvote{
 		Answer: oneAnswer,
 		User:   user,
 	}
-	db.Create(&oneAUpVote)
-	log.AccessHandler(r, 200)
+	err := h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&oneAUpVote).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Create, EntityType: "answer_upvote", EntityID: oneAUpVote.ID, After: oneAUpVote,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+	}
 	return
 }
 
 // DeleteAnswerUpvote removes upvote from oneAnswer
-func DeleteAnswerUpvote(w http.ResponseWriter, r *http.Request) {
+func (h *handler) DeleteAnswerUpvote(w http.ResponseWriter, r *http.Request) {
 	// Check if user is logged in
-	_, email := core.GetTokenEmail(r)
+	_, email := h.sessions.GetTokenEmail(r)
 	if email == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOOne)
 		return
 	}
 
@@ -621,34 +629,44 @@ func DeleteAnswerUpvote(w http.ResponseWriter, r *http.Request) {
 	slug := params["slug"]
 	questionSlug := params["questionSlug"]
 
-	if !(XExists(questionSlug, "question") && XExists(slug, "answer")) {
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(core.FourOFour)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 404)
+	if !(h.XExists(r.Context(), questionSlug, "question") && h.XExists(r.Context(), slug, "answer")) {
+		core.WriteProblem(w, r, core.FourOFour)
 		return
 	}
 
-	db.Preload(clause.Associations).Find(&oneQuestion, "slug = ?", questionSlug)
-	db.Preload(clause.Associations).Find(&oneAnswer, "slug = ? AND question_id = ?", slug, oneQuestion.ID)
+	var (
+		oneQuestion question
+		oneAnswer   answer
+		oneAUpVote  answerUpvote
+		user        account.User
+	)
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Find(&oneQuestion, "slug = ?", questionSlug)
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Find(&oneAnswer, "slug = ? AND question_id = ?", slug, oneQuestion.ID)
 
-	db.Preload(clause.Associations).Find(&user, "email = ?", strings.ToLower(email))
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Find(&user, "email = ?", strings.ToLower(email))
 
-	db.Preload(clause.Associations).Find(&oneAUpVote, "user_id = ? AND answer_id = ?", user.ID, oneAnswer.ID)
+	h.db.WithContext(r.Context()).Preload(clause.Associations).Find(&oneAUpVote, "user_id = ? AND answer_id = ?", user.ID, oneAnswer.ID)
 
 	// Check if logged in user posted the upvote. If not, no permission to delete.
 	if email != oneAUpVote.User.Email {
-		fmt.Println(oneAUpVote.User.Email)
-		w.WriteHeader(http.StatusUnauthorized)
-		err := json.NewEncoder(w).Encode(core.FourOOne)
-		log.ErrorHandler(err)
-		log.AccessHandler(r, 401)
+		core.WriteProblem(w, r, core.FourOThree)
 		return
 	}
 
-	db.Preload(clause.Associations).Find(&oneAUpVote, "user_id = ? AND answer_id = ?", user.ID, oneAnswer.ID).Delete(&oneAUpVote)
+	err := h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&answerUpvote{}, oneAUpVote.ID).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, r, audit.Change{
+			Actor: email, Action: audit.Delete, EntityType: "answer_upvote", EntityID: oneAUpVote.ID, Before: oneAUpVote,
+		})
+	})
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
-	log.AccessHandler(r, 204)
 	return
 }
 
@@ -656,9 +674,7 @@ func DeleteAnswerUpvote(w http.ResponseWriter, r *http.Request) {
 //  oneQuestion search
 
 // QuestionSearch : Search for oneQuestion with query parameter
-func QuestionSearch(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
+func (h *handler) QuestionSearch(w http.ResponseWriter, r *http.Request) {
 	// Common oneQuestion words
 	questionWords := []string{"why", "who", "what", "how", "whom", "when", "where", "are", "is", "the", "whose"}
 
@@ -676,37 +692,29 @@ func QuestionSearch(w http.ResponseWriter, r *http.Request) {
 
 	individualWords := strings.Fields(final)
 
-	var questionList []question
+	// A question matches if its title has any of the words
+	conditions := make([]string, 0, len(individualWords))
+	args := make([]interface{}, 0, len(individualWords))
 	for _, word := range individualWords {
-		db.Where("lower(title) LIKE ?", "%"+strings.ToLower(word)+"%").Find(&questions)
-		questionList = append(questionList, questions...)
+		conditions = append(conditions, "lower(title) LIKE ?")
+		args = append(args, "%"+strings.ToLower(word)+"%")
+	}
+	search := "1 = 0"
+	if len(conditions) > 0 {
+		search = strings.Join(conditions, " OR ")
 	}
 
-	w.WriteHeader(http.StatusOK)
-	err := json.NewEncoder(w).Encode(questionList)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
-	return
+	var questions []question
+	pagination.List(w, r, h.db.WithContext(r.Context()).Model(&question{}).Where(search, args...), &questions)
 }
 
 // FilterQuestionByTags : Get oneQuestion that have a particular tag or tags
-func FilterQuestionByTags(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+func (h *handler) FilterQuestionByTags(w http.ResponseWriter, r *http.Request) {
 	filterQuery := r.URL.Query().Get("filter")
 	tags := strings.Split(filterQuery, ",")
-	var questionIDs []uint
-
-	var questionTags []questionTag
-	db.Where("name IN ?", tags).Find(&questionTags)
 
-	for _, questionTag := range questionTags {
-		questionIDs = append(questionIDs, questionTag.QuestionID)
-	}
+	tagged := h.db.WithContext(r.Context()).Model(&questionTag{}).Select("question_id").Where("name IN ?", tags)
 
-	db.Preload(clause.Associations).Find(&questions, "id IN ?", questionIDs)
-	w.WriteHeader(http.StatusOK)
-	err := json.NewEncoder(w).Encode(questions)
-	log.ErrorHandler(err)
-	log.AccessHandler(r, 200)
-	return
+	var questions []question
+	pagination.List(w, r, h.db.WithContext(r.Context()).Model(&question{}).Preload(clause.Associations).Where("id IN (?)", tagged), &questions)
 }
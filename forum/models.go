@@ -64,3 +64,28 @@ type answerUpvote struct {
 	UserID    int          `json:"user_id"`
 	User      account.User `json:"user" gorm:"constraints:OnDelete:CASCADE"`
 }
+
+// questionRequest is what a user sends to ask a question
+type questionRequest struct {
+	Title       string       `json:"title" validate:"required,max=300"`
+	Description string       `json:"description" validate:"max=10000"`
+	Tags        []tagRequest `json:"tags" validate:"max=10"`
+}
+
+// questionUpdate is what a user sends to change a question. Fields that are left out keep their value,
+// and tags are added to the ones the question already has.
+type questionUpdate struct {
+	Title       *string      `json:"title" validate:"required,max=300"`
+	Description *string      `json:"description" validate:"max=10000"`
+	Tags        []tagRequest `json:"tags" validate:"max=10"`
+}
+
+// tagRequest is a tag attached to a question
+type tagRequest struct {
+	Name string `json:"name" validate:"required,max=50"`
+}
+
+// answerRequest is what a user sends to answer a question, or to change their answer
+type answerRequest struct {
+	Response string `json:"response" validate:"required,max=10000"`
+}
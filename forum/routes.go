@@ -1,29 +1,38 @@
 package forum
 
-import "github.com/gorilla/mux"
+import (
+	"bookateriago/app"
+	"bookateriago/slugs"
+
+	"github.com/gorilla/mux"
+)
 
 // Router - All routes for forum feature
-func Router(router *mux.Router) *mux.Router {
+func Router(router *mux.Router, a *app.App) *mux.Router {
+	h := &handler{db: a.DB, sessions: a.Sessions}
+
 	subRouter := router.PathPrefix("/question").Subrouter()
-	subRouter.HandleFunc("/search-all", QuestionSearch).Queries("search", "{search}").Methods("GET")
-	subRouter.HandleFunc("/filter-by-tags", FilterQuestionByTags).Queries("filter", "{filter}").Methods("GET")
-	subRouter.HandleFunc("/all", GetQuestions).Methods("GET")
-	subRouter.HandleFunc("/{slug}", GetQuestion).Methods("GET")
-	subRouter.HandleFunc("", PostQuestion).Methods("POST")
-	subRouter.HandleFunc("/{slug}", UpdateQuestion).Methods("PUT")
-	subRouter.HandleFunc("/{slug}", DeleteQuestion).Methods("DELETE")
-	subRouter.HandleFunc("/{slug}/up-votes", GetQuestionUpVotes).Methods("GET")
-	subRouter.HandleFunc("/{slug}/up-votes", PostQuestionUpVote).Methods("POST")
-	subRouter.HandleFunc("/{slug}/up-votes/{id}", DeleteQuestionUpvote).Methods("DELETE")
+	subRouter.Use(slugs.Redirects(a.DB, "questions", "slug"))
+	subRouter.HandleFunc("/search-all", a.Cache.Cached(h.QuestionSearch, "forum")).Queries("search", "{search}").Methods("GET")
+	subRouter.HandleFunc("/filter-by-tags", a.Cache.Cached(h.FilterQuestionByTags, "forum")).Queries("filter", "{filter}").Methods("GET")
+	subRouter.HandleFunc("/all", a.Cache.Cached(h.GetQuestions, "forum")).Methods("GET")
+	subRouter.HandleFunc("/{slug}", a.Cache.Cached(h.GetQuestion, "forum")).Methods("GET")
+	subRouter.HandleFunc("", a.Cache.Invalidates(h.PostQuestion, "forum")).Methods("POST")
+	subRouter.HandleFunc("/{slug}", a.Cache.Invalidates(h.UpdateQuestion, "forum")).Methods("PUT")
+	subRouter.HandleFunc("/{slug}", a.Cache.Invalidates(h.DeleteQuestion, "forum")).Methods("DELETE")
+	subRouter.HandleFunc("/{slug}/up-votes", a.Cache.Cached(h.GetQuestionUpVotes, "forum")).Methods("GET")
+	subRouter.HandleFunc("/{slug}/up-votes", a.Cache.Invalidates(h.PostQuestionUpVote, "forum")).Methods("POST")
+	subRouter.HandleFunc("/{slug}/up-votes/{id}", a.Cache.Invalidates(h.DeleteQuestionUpvote, "forum")).Methods("DELETE")
 
 	subRouter = router.PathPrefix("/{questionSlug}/answer").Subrouter()
-	subRouter.HandleFunc("/all", GetAnswers).Methods("GET")
-	subRouter.HandleFunc("/{slug}", GetAnswer).Methods("GET")
-	subRouter.HandleFunc("", PostAnswer).Methods("POST")
-	subRouter.HandleFunc("/{slug}", UpdateAnswer).Methods("PUT")
-	subRouter.HandleFunc("/{slug}", DeleteAnswer).Methods("DELETE")
-	subRouter.HandleFunc("/{slug}/up-votes", GetAnswerUpVotes).Methods("GET")
-	subRouter.HandleFunc("/{slug}/up-votes", PostAnswerUpVote).Methods("POST")
-	subRouter.HandleFunc("/{slug}/up-votes/", DeleteAnswerUpvote).Methods("DELETE")
+	subRouter.Use(slugs.Redirects(a.DB, "questions", "questionSlug"))
+	subRouter.HandleFunc("/all", a.Cache.Cached(h.GetAnswers, "forum")).Methods("GET")
+	subRouter.HandleFunc("/{slug}", a.Cache.Cached(h.GetAnswer, "forum")).Methods("GET")
+	subRouter.HandleFunc("", a.Cache.Invalidates(h.PostAnswer, "forum")).Methods("POST")
+	subRouter.HandleFunc("/{slug}", a.Cache.Invalidates(h.UpdateAnswer, "forum")).Methods("PUT")
+	subRouter.HandleFunc("/{slug}", a.Cache.Invalidates(h.DeleteAnswer, "forum")).Methods("DELETE")
+	subRouter.HandleFunc("/{slug}/up-votes", a.Cache.Cached(h.GetAnswerUpVotes, "forum")).Methods("GET")
+	subRouter.HandleFunc("/{slug}/up-votes", a.Cache.Invalidates(h.PostAnswerUpVote, "forum")).Methods("POST")
+	subRouter.HandleFunc("/{slug}/up-votes/", a.Cache.Invalidates(h.DeleteAnswerUpvote, "forum")).Methods("DELETE")
 	return router
 }
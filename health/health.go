@@ -0,0 +1,169 @@
+// Package health tells load balancers whether the server is alive and ready for traffic, and admins what
+// is running: the build, how long it has been up, the schema version and the state of every dependency.
+package health
+
+import (
+	emails "bookateriago/email"
+	"bookateriago/log"
+	"bookateriago/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// probeKey is the storage object looked up to reach the storage backend. It doesn't need to exist.
+const probeKey = ".health"
+
+// Results of a check
+const (
+	OK          = "ok"
+	Unavailable = "unavailable"
+)
+
+// started is when the server started, for the uptime
+var started = time.Now()
+
+// Checker checks the dependencies of the server, each given timeout to answer
+type Checker struct {
+	db      *gorm.DB
+	redis   *redis.Client
+	store   storage.Storage
+	mailer  emails.Mailer
+	timeout time.Duration
+}
+
+// check is one dependency of the server
+type check struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// Check is the result of checking a dependency
+type Check struct {
+	Status string `json:"status"`
+	// Duration is how long the check took, in milliseconds
+	Duration float64 `json:"duration_ms"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// New checks the given dependencies, each given timeout to answer
+func New(db *gorm.DB, client *redis.Client, store storage.Storage, mailer emails.Mailer, timeout time.Duration) *Checker {
+	return &Checker{db: db, redis: client, store: store, mailer: mailer, timeout: timeout}
+}
+
+func (c *Checker) checks() []check {
+	return []check{
+		{"database", func(ctx context.Context) error {
+			sqlDB, err := c.db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		}},
+		{"redis", func(ctx context.Context) error {
+			return c.redis.Ping(ctx).Err()
+		}},
+		{"storage", func(ctx context.Context) error {
+			// Any answer but a failure means the backend is reachable
+			if _, err := c.store.Stat(ctx, probeKey); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+			return nil
+		}},
+		{"email", func(ctx context.Context) error {
+			return emails.Check(ctx, c.mailer)
+		}},
+	}
+}
+
+// Run checks every dependency at once and returns the results by name, and whether all of them passed
+func (c *Checker) Run(ctx context.Context) (map[string]Check, bool) {
+	all := c.checks()
+	results := make(map[string]Check, len(all))
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+	for _, one := range all {
+		wait.Add(1)
+		go func(one check) {
+			defer wait.Done()
+			ctx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := run(ctx, one.run)
+			result := Check{Status: OK, Duration: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				result.Status = Unavailable
+				result.Error = err.Error()
+			}
+			mutex.Lock()
+			results[one.name] = result
+			mutex.Unlock()
+		}(one)
+	}
+	wait.Wait()
+
+	for _, result := range results {
+		if result.Status != OK {
+			return results, false
+		}
+	}
+	return results, true
+}
+
+// run gives up on fn when ctx is done, for checks that don't watch their context, like the SMTP dial
+// of some platforms or a file system that hangs
+func run(ctx context.Context, fn func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Liveness answers 200 as long as the server can serve requests at all. It doesn't look at the dependencies:
+// restarting the server wouldn't bring them back, /readyz takes it out of rotation instead.
+func Liveness(w http.ResponseWriter, r *http.Request) {
+	write(w, r, http.StatusOK, map[string]string{"status": OK})
+}
+
+// Readiness answers 200 when every dependency is up and 503 when one is not, so the load balancer only sends
+// traffic to servers that can handle it. What failed is logged rather than sent, the endpoint is public.
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	results, ready := c.Run(r.Context())
+	statuses := make(map[string]string, len(results))
+	for name, result := range results {
+		statuses[name] = result.Status
+		if result.Error != "" {
+			log.Warn("readiness check failed", log.Fields{"check": name, "error": result.Error})
+		}
+	}
+
+	status := http.StatusOK
+	overall := OK
+	if !ready {
+		status = http.StatusServiceUnavailable
+		overall = Unavailable
+	}
+	write(w, r, status, map[string]interface{}{"status": overall, "checks": statuses})
+}
+
+// write sends body as JSON. Probes must always see the current state, never a cached one.
+func write(w http.ResponseWriter, r *http.Request, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(body)
+	log.ErrorContext(r.Context(), err)
+}
@@ -0,0 +1,111 @@
+package health
+
+import (
+	"bookateriago/migrations"
+	"context"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Version, Commit and BuildTime describe the build. They are set when building, e.g.
+//
+//	go build -ldflags "-X bookateriago/health.Version=1.4.0 -X bookateriago/health.Commit=$(git rev-parse HEAD)"
+//
+// Version falls back to the module version Go recorded, if any.
+var (
+	Version   = ""
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Build is what the running binary was built from
+type Build struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// Schema is the migration version of the database against the latest one the binary knows
+type Schema struct {
+	Version int64  `json:"version"`
+	Latest  int64  `json:"latest"`
+	Pending int    `json:"pending"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Status is everything the admin status page shows
+type Status struct {
+	Status    string    `json:"status"`
+	Build     Build     `json:"build"`
+	StartedAt time.Time `json:"started_at"`
+	// Uptime is in seconds
+	Uptime     int64            `json:"uptime"`
+	Migrations Schema           `json:"migrations"`
+	Checks     map[string]Check `json:"checks"`
+}
+
+// Report runs the checks and gathers the status of the server
+func (c *Checker) Report(ctx context.Context) Status {
+	results, ready := c.Run(ctx)
+	status := Status{
+		Status:     OK,
+		Build:      build(),
+		StartedAt:  started,
+		Uptime:     int64(time.Since(started).Seconds()),
+		Migrations: c.schema(ctx),
+		Checks:     results,
+	}
+	if !ready {
+		status.Status = Unavailable
+	}
+	return status
+}
+
+func build() Build {
+	info := Build{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+		if module, ok := debug.ReadBuildInfo(); ok && module.Main.Version != "" && module.Main.Version != "(devel)" {
+			info.Version = module.Main.Version
+		}
+	}
+	return info
+}
+
+func (c *Checker) schema(ctx context.Context) Schema {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var result Schema
+	// The latest migration is known even when the database is down
+	if all, err := migrations.All(); err == nil && len(all) > 0 {
+		result.Latest = all[len(all)-1].Version
+	}
+	sqlDB, err := c.db.DB()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	statuses, err := migrations.List(ctx, sqlDB)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			result.Pending++
+		} else if status.Version > result.Version {
+			result.Version = status.Version
+		}
+	}
+	return result
+}
@@ -0,0 +1,154 @@
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fallback is the language used when nothing better is available. Every key must exist in it.
+const Fallback = "en"
+
+// contextKey is the type of the key the negotiated language is stored under in a request context
+type contextKey struct{}
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// catalog maps a language to its messages, loaded from the locales directory
+var catalog = loadCatalog()
+
+// loadCatalog reads every locales/<language>.json file
+func loadCatalog() map[string]map[string]string {
+	messages := map[string]map[string]string{}
+	files, err := localeFS.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		content, err := localeFS.ReadFile("locales/" + file.Name())
+		if err != nil {
+			panic(err)
+		}
+		var entries map[string]string
+		if err = json.Unmarshal(content, &entries); err != nil {
+			panic(err)
+		}
+		messages[strings.TrimSuffix(file.Name(), path.Ext(file.Name()))] = entries
+	}
+	return messages
+}
+
+// Supported checks if there is a catalog for the language, e.g. "fr" but not "de"
+func Supported(language string) bool {
+	_, ok := catalog[strings.ToLower(language)]
+	return ok
+}
+
+// Fallbacks is the order languages are tried in for the given one.
+// "fr-CA" gives fr-ca, fr and then en.
+func Fallbacks(language string) []string {
+	var chain []string
+	language = strings.ToLower(strings.ReplaceAll(language, "_", "-"))
+	for language != "" {
+		chain = append(chain, language)
+		i := strings.LastIndex(language, "-")
+		if i < 0 {
+			break
+		}
+		language = language[:i]
+	}
+	if len(chain) == 0 || chain[len(chain)-1] != Fallback {
+		chain = append(chain, Fallback)
+	}
+	return chain
+}
+
+// T translates key into the language, going down its fallback chain until a translation is found.
+// The key itself is returned if nothing is found at all.
+func T(language, key string) string {
+	for _, candidate := range Fallbacks(language) {
+		if message, ok := catalog[candidate][key]; ok {
+			return message
+		}
+	}
+	return key
+}
+
+// Negotiate picks the best supported language from an Accept-Language header,
+// e.g. "fr-CA,fr;q=0.9,en;q=0.8" gives fr. Fallback is returned when nothing matches.
+func Negotiate(header string) string {
+	type preference struct {
+		language string
+		quality  float64
+	}
+	var preferences []preference
+
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		language := strings.TrimSpace(fields[0])
+		if language == "" || language == "*" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality > 0 {
+			preferences = append(preferences, preference{language, quality})
+		}
+	}
+
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].quality > preferences[j].quality
+	})
+	for _, preferred := range preferences {
+		for _, candidate := range Fallbacks(preferred.language) {
+			if Supported(candidate) {
+				// Stop at the fallback, a later preference might still be supported
+				if candidate == Fallback && !strings.HasPrefix(strings.ToLower(preferred.language), Fallback) {
+					break
+				}
+				return candidate
+			}
+		}
+	}
+	return Fallback
+}
+
+// Middleware negotiates the language of every request from its Accept-Language header.
+// The result is available through FromContext and sent back in Content-Language.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		language := Negotiate(r.Header.Get("Accept-Language"))
+		w.Header().Set("Content-Language", language)
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, language)))
+	})
+}
+
+// FromContext returns the language negotiated by Middleware, or Fallback outside of a request
+func FromContext(ctx context.Context) string {
+	if language, ok := ctx.Value(contextKey{}).(string); ok {
+		return language
+	}
+	return Fallback
+}
+
+// FromRequest returns the language of the request, negotiating it if Middleware didn't already
+func FromRequest(r *http.Request) string {
+	if language, ok := r.Context().Value(contextKey{}).(string); ok {
+		return language
+	}
+	return Negotiate(r.Header.Get("Accept-Language"))
+}
@@ -0,0 +1,95 @@
+package i18n
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", Fallback},
+		{"fr", "fr"},
+		{"FR-ca", "fr"},
+		{"fr-CA,fr;q=0.9,en;q=0.8", "fr"},
+		{"en;q=0.8,fr;q=0.9", "fr"},
+		{"de,fr;q=0.5", "fr"},
+		{"de,en-GB;q=0.7,fr;q=0.5", "en"},
+		{"fr;q=0,en", "en"},
+		{"de, *", Fallback},
+		{"fr;q=abc", "fr"},
+		{" , ;q=1", Fallback},
+	}
+
+	for _, test := range tests {
+		if got := Negotiate(test.header); got != test.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", test.header, got, test.want)
+		}
+	}
+}
+
+func TestFallbacks(t *testing.T) {
+	tests := []struct {
+		language string
+		want     []string
+	}{
+		{"fr-CA", []string{"fr-ca", "fr", "en"}},
+		{"zh_Hant_TW", []string{"zh-hant-tw", "zh-hant", "zh", "en"}},
+		{"en-US", []string{"en-us", "en"}},
+		{"en", []string{"en"}},
+		{"", []string{"en"}},
+	}
+
+	for _, test := range tests {
+		if got := Fallbacks(test.language); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Fallbacks(%q) = %q, want %q", test.language, got, test.want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	key := "email.token.subject"
+	english, french := catalog["en"][key], catalog["fr"][key]
+	if english == "" || french == "" || english == french {
+		t.Fatalf("%s isn't translated in both catalogs", key)
+	}
+
+	tests := []struct {
+		language string
+		key      string
+		want     string
+	}{
+		{"fr-CA", key, french},
+		{"de", key, english},
+		{"fr", "no.such.key", "no.such.key"},
+	}
+
+	for _, test := range tests {
+		if got := T(test.language, test.key); got != test.want {
+			t.Errorf("T(%q, %q) = %q, want %q", test.language, test.key, got, test.want)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var negotiated string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		negotiated = FromRequest(r)
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "fr-CA,en;q=0.5")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if negotiated != "fr" {
+		t.Errorf("FromRequest() = %q, want fr", negotiated)
+	}
+	if language := w.Header().Get("Content-Language"); language != "fr" {
+		t.Errorf("Content-Language %q, want fr", language)
+	}
+}
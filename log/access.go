@@ -0,0 +1,124 @@
+package log
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The access log format and the share of requests logged, set by Setup
+var (
+	accessFormat = "json"
+	accessSample = 1.0
+)
+
+// clfTime is the time format of the Common Log Format
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// responseRecorder notes what a handler sends: its status and how many bytes of body
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the recorder
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// logAccess writes the access log entry of a request. Failed requests are always logged, the rest are
+// sampled when the access log is set to keep only a share of them.
+func logAccess(r *http.Request, s *scope, recorder *responseRecorder) {
+	status := recorder.status
+	if status == 0 {
+		// Nothing was written, net/http answers 200 with an empty body
+		status = http.StatusOK
+	}
+	if status < 400 && accessSample < 1 && rand.Float64() >= accessSample {
+		return
+	}
+	latency := time.Since(s.start)
+
+	switch accessFormat {
+	case "clf", "combined":
+		line := fmt.Sprintf("%s - %s [%s] %q %d %s", remoteHost(r), clfUser(s), s.start.Format(clfTime),
+			r.Method+" "+r.URL.RequestURI()+" "+r.Proto, status, clfBytes(recorder.bytes))
+		if accessFormat == "combined" {
+			line += fmt.Sprintf(" %q %q", clfField(r.Referer()), clfField(r.UserAgent()))
+		}
+		for _, out := range access.outs {
+			out.write([]byte(line + "\n"))
+		}
+	default:
+		fields := Fields{
+			"status":      status,
+			"bytes":       recorder.bytes,
+			"latency_ms":  float64(latency.Microseconds()) / 1000,
+			"remote_addr": remoteHost(r),
+		}
+		if r.URL.RawQuery != "" {
+			fields["query"] = r.URL.RawQuery
+		}
+		if referer := r.Referer(); referer != "" {
+			fields["referer"] = referer
+		}
+		if agent := r.UserAgent(); agent != "" {
+			fields["user_agent"] = agent
+		}
+		requestLogger(r.Context(), access).Info(r.Method+" "+r.URL.Path, fields)
+	}
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clfUser is the user ID of the request, or - when nobody is signed in
+func clfUser(s *scope) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, ok := s.fields["user_id"]; ok {
+		return fmt.Sprint(id)
+	}
+	return "-"
+}
+
+func clfBytes(bytes int64) string {
+	if bytes == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(bytes, 10)
+}
+
+func clfField(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
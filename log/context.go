@@ -0,0 +1,96 @@
+package log
+
+import (
+	"bookateriago/requestid"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type contextKey struct{}
+
+// scope holds the fields of one request. Some only become known while the handler runs, like the user,
+// so they are added to the scope rather than to a new context.
+type scope struct {
+	mu     sync.Mutex
+	start  time.Time
+	fields Fields
+}
+
+// Middleware starts the log scope of a request, with its ID, method and path, and writes its access log
+// entry once it is answered. It wraps the whole router, inside requestid.Middleware, so requests that match
+// no route are logged too.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &scope{start: time.Now(), fields: Fields{"method": r.Method, "path": r.URL.Path}}
+		if id := requestid.FromContext(r.Context()); id != "" {
+			s.fields["request_id"] = id
+		}
+		r = r.WithContext(context.WithValue(r.Context(), contextKey{}, s))
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		logAccess(r, s, recorder)
+	})
+}
+
+// Route adds the template of the route a request matched, e.g. /question/{slug}, to its log scope.
+// It is a router middleware, as routes are only known once the router has matched one.
+func Route(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				AddFields(r.Context(), Fields{"route": template})
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AddFields adds fields to every later entry logged for the request ctx belongs to
+func AddFields(ctx context.Context, fields Fields) {
+	s := scopeOf(ctx)
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, value := range fields {
+		s.fields[key] = value
+	}
+}
+
+// FromContext returns the application logger with the fields of the request ctx belongs to
+func FromContext(ctx context.Context) *Logger {
+	return requestLogger(ctx, std)
+}
+
+// ErrorContext logs err, if there is one, to the application log with the fields of the request
+func ErrorContext(ctx context.Context, err error) {
+	if err == nil {
+		return
+	}
+	FromContext(ctx).Error(err.Error())
+}
+
+func requestLogger(ctx context.Context, logger *Logger) *Logger {
+	s := scopeOf(ctx)
+	if s == nil {
+		// Outside Middleware, e.g. for unmatched routes, there is at most the request ID
+		if id := requestid.FromContext(ctx); id != "" {
+			return logger.With(Fields{"request_id": id})
+		}
+		return logger
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return logger.With(s.fields)
+}
+
+func scopeOf(ctx context.Context) *scope {
+	s, _ := ctx.Value(contextKey{}).(*scope)
+	return s
+}
@@ -1,61 +1,219 @@
+// Package log writes structured logs: one JSON object per line, with a time, a level, a message and any
+// fields added to it. Application logs and access logs go to separate outputs, set up by Setup.
 package log
 
 import (
-	"log"
-	"net/http"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
-// ErrorHandler deals with logging errors in error.log
-func ErrorHandler(err error) {
-	if err == nil {
-		return
+// Level is how important an entry is. Entries below the level of a Logger are dropped.
+type Level int
+
+// The levels, from least to most important
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < DebugLevel || l > ErrorLevel {
+		return fmt.Sprintf("level(%d)", int(l))
 	}
-	file, issue := os.OpenFile("log/error.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if issue != nil {
-		log.Printf("Error opening file: %v", issue)
-		return
+	return levelNames[l]
+}
+
+// ParseLevel reads a level by its name: debug, info, warn or error
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
 	}
+	return InfoLevel, fmt.Errorf("log: unknown level %q", name)
+}
+
+// Fields are the extra keys and values of an entry. Errors are written as their message.
+type Fields map[string]interface{}
 
-	log.SetOutput(file)
-	log.Println(err)
-	err = file.Close()
-	log.Println(err)
-	return
+// reserved keys are written for every entry, fields with the same name are left out
+var reserved = map[string]bool{"time": true, "level": true, "msg": true}
+
+// output is a writer shared by loggers. Every entry is written in one call under the lock,
+// so concurrent requests never interleave their lines.
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (o *output) write(line []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, err := o.w.Write(line); err != nil {
+		fmt.Fprintf(os.Stderr, "log: %v\n", err)
+	}
 }
 
-// AccessHandler logs all access and responses to access.log
-func AccessHandler(r *http.Request, code int) {
-	file, issue := os.OpenFile("log/access.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if issue != nil {
-		log.Printf("Error opening file: %v", issue)
+// Logger writes entries at or above its level, with its fields added to each of them
+type Logger struct {
+	outs   []*output
+	level  Level
+	fields Fields
+}
+
+// New returns a Logger writing to w
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{outs: []*output{{w: w}}, level: level}
+}
+
+// With returns a Logger that adds fields to every entry, on top of the ones l adds
+func (l *Logger) With(fields Fields) *Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for key, value := range l.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return &Logger{outs: l.outs, level: l.level, fields: merged}
+}
+
+// Enabled tells if entries of level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+// Debug writes an entry for developers
+func (l *Logger) Debug(msg string, fields ...Fields) {
+	l.log(DebugLevel, msg, fields)
+}
+
+// Info writes an entry about something that went as expected
+func (l *Logger) Info(msg string, fields ...Fields) {
+	l.log(InfoLevel, msg, fields)
+}
+
+// Warn writes an entry about something unexpected that was dealt with
+func (l *Logger) Warn(msg string, fields ...Fields) {
+	l.log(WarnLevel, msg, fields)
+}
+
+// Error writes an entry about something that failed
+func (l *Logger) Error(msg string, fields ...Fields) {
+	l.log(ErrorLevel, msg, fields)
+}
+
+func (l *Logger) log(level Level, msg string, fields []Fields) {
+	if !l.Enabled(level) {
 		return
 	}
 
-	log.SetOutput(file)
-	text := r.Method + " - " + r.URL.Path
-	if len(r.URL.Query()) > 0 {
-		text += "?" + strings.ReplaceAll(r.URL.Query().Encode(), "%2C", ",")
+	entry := make(Fields, len(l.fields))
+	for key, value := range l.fields {
+		entry[key] = value
+	}
+	for _, extra := range fields {
+		for key, value := range extra {
+			entry[key] = value
+		}
+	}
+	keys := make([]string, 0, len(entry))
+	for key := range entry {
+		if !reserved[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var line bytes.Buffer
+	line.WriteString(`{"time":`)
+	writeValue(&line, time.Now().UTC().Format(time.RFC3339Nano))
+	line.WriteString(`,"level":`)
+	writeValue(&line, level.String())
+	line.WriteString(`,"msg":`)
+	writeValue(&line, msg)
+	for _, key := range keys {
+		line.WriteByte(',')
+		writeValue(&line, key)
+		line.WriteByte(':')
+		writeValue(&line, entry[key])
+	}
+	line.WriteString("}\n")
+	for _, out := range l.outs {
+		out.write(line.Bytes())
 	}
-	log.Println(text + " - " + "[" + strconv.Itoa(code) + "]")
-	err := file.Close()
-	ErrorHandler(err)
-	return
 }
 
-// Start logs general text, string to access.log
-func Start(text string) {
-	file, issue := os.OpenFile("log/access.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if issue != nil {
-		log.Printf("Error opening file: %v", issue)
+// writeValue writes value as JSON. Values that can't be are written as text.
+func writeValue(line *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = v.String()
+	}
+
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		encoded.Reset()
+		_ = encoder.Encode(fmt.Sprint(value))
+	}
+	line.Write(bytes.TrimSuffix(encoded.Bytes(), []byte("\n")))
+}
+
+// The application and access loggers. They write to stderr until Setup points them elsewhere.
+var (
+	std    = New(os.Stderr, InfoLevel)
+	access = &Logger{outs: std.outs, level: InfoLevel}
+)
+
+// Default returns the application logger
+func Default() *Logger {
+	return std
+}
+
+// Debug writes an entry to the application log
+func Debug(msg string, fields ...Fields) {
+	std.Debug(msg, fields...)
+}
+
+// Info writes an entry to the application log
+func Info(msg string, fields ...Fields) {
+	std.Info(msg, fields...)
+}
+
+// Warn writes an entry to the application log
+func Warn(msg string, fields ...Fields) {
+	std.Warn(msg, fields...)
+}
+
+// Error writes an entry to the application log
+func Error(msg string, fields ...Fields) {
+	std.Error(msg, fields...)
+}
+
+// ErrorHandler logs err, if there is one, to the application log
+func ErrorHandler(err error) {
+	if err == nil {
 		return
 	}
+	std.Error(err.Error())
+}
 
-	log.SetOutput(file)
-	log.Println(text)
-	err := file.Close()
-	ErrorHandler(err)
-	return
+// Start logs general text to the application log
+func Start(text string) {
+	std.Info(text)
 }
@@ -0,0 +1,80 @@
+package log
+
+import (
+	"bookateriago/config"
+	"os"
+)
+
+// files are the log files opened by Setup
+var files []*rotatingFile
+
+// Setup points the application and access logs at the outputs in the settings: stdout, files or both.
+// It is meant to run once at startup, before any request is served.
+func Setup(settings config.LogConfig) error {
+	level, err := ParseLevel(settings.Level)
+	if err != nil {
+		return err
+	}
+
+	var stdOuts, accessOuts []*output
+	if settings.Output == "stdout" || settings.Output == "both" {
+		stdout := &output{w: os.Stdout}
+		stdOuts = append(stdOuts, stdout)
+		accessOuts = append(accessOuts, stdout)
+	}
+	if settings.Output == "file" || settings.Output == "both" {
+		file, err := openFile(settings.File, settings)
+		if err != nil {
+			return err
+		}
+		stdOuts = append(stdOuts, &output{w: file})
+
+		file, err = openFile(settings.AccessFile, settings)
+		if err != nil {
+			_ = Close()
+			return err
+		}
+		accessOuts = append(accessOuts, &output{w: file})
+	}
+
+	accessFormat = settings.AccessFormat
+	accessSample = settings.AccessSample
+	std = &Logger{outs: stdOuts, level: level}
+	// Access entries are all info, so the access log ignores the level
+	access = &Logger{outs: accessOuts, level: InfoLevel}
+	return nil
+}
+
+// Reopen closes the log files and opens them again, for when logrotate or an operator has moved them
+func Reopen() error {
+	var firstErr error
+	for _, file := range files {
+		if err := file.Reopen(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Close closes the log files and sends later entries back to stderr
+func Close() error {
+	var firstErr error
+	for _, file := range files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	files = nil
+	std = New(os.Stderr, std.level)
+	access = &Logger{outs: std.outs, level: InfoLevel}
+	return firstErr
+}
+
+func openFile(path string, settings config.LogConfig) (*rotatingFile, error) {
+	file, err := openRotating(path, settings)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, file)
+	return file, nil
+}
@@ -0,0 +1,232 @@
+package log
+
+import (
+	"bookateriago/config"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTime names rotated files, e.g. error.log.2021-03-01T17-00-00.000. It sorts in time order.
+const backupTime = "2006-01-02T15-04-05.000"
+
+// rotatingFile is a log file that is moved aside and started over when it gets too big or too old.
+// Rotated files are compressed and only the newest few are kept.
+type rotatingFile struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64
+	// period is the start of the time period the file is for, it rotates when a write falls in the next one
+	period time.Time
+
+	maxSize    int64
+	every      time.Duration
+	maxBackups int
+	compress   bool
+
+	// cleanup compresses and prunes rotated files in the background, one rotation at a time
+	cleanup sync.Mutex
+	pending sync.WaitGroup
+}
+
+// openRotating opens the log file at path, rotated as the settings say
+func openRotating(path string, settings config.LogConfig) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:       path,
+		maxSize:    settings.MaxSize,
+		every:      settings.RotateEvery,
+		maxBackups: settings.MaxBackups,
+		compress:   settings.Compress,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the file at path for appending. A file left from before belongs to the period it was last
+// written in, so it is rotated on the first write if that period is over.
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.period = f.periodOf(info.ModTime())
+	if info.Size() == 0 {
+		f.period = f.periodOf(time.Now())
+	}
+	return nil
+}
+
+func (f *rotatingFile) periodOf(t time.Time) time.Time {
+	if f.every <= 0 {
+		return time.Time{}
+	}
+	return t.UTC().Truncate(f.every)
+}
+
+func (f *rotatingFile) Write(data []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	tooBig := f.maxSize > 0 && f.size > 0 && f.size+int64(len(data)) > f.maxSize
+	tooOld := f.every > 0 && f.periodOf(time.Now()).After(f.period)
+	if tooBig || tooOld {
+		if err := f.rotate(); err != nil {
+			// Keep logging to the file we have rather than losing entries
+			fmt.Fprintf(os.Stderr, "log: rotating %s: %v\n", f.path, err)
+			if f.file == nil {
+				return 0, err
+			}
+		}
+	}
+
+	n, err := f.file.Write(data)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate moves the file aside and starts a new one. Compressing and pruning happen in the background.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	backup := f.path + "." + time.Now().UTC().Format(backupTime)
+	renameErr := os.Rename(f.path, backup)
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.period = f.periodOf(time.Now())
+	if renameErr != nil {
+		return renameErr
+	}
+
+	f.pending.Add(1)
+	go func() {
+		defer f.pending.Done()
+		f.cleanup.Lock()
+		defer f.cleanup.Unlock()
+		if f.compress {
+			if err := compress(backup); err != nil {
+				fmt.Fprintf(os.Stderr, "log: compressing %s: %v\n", backup, err)
+			}
+		}
+		if err := f.prune(); err != nil {
+			fmt.Fprintf(os.Stderr, "log: removing old logs of %s: %v\n", f.path, err)
+		}
+	}()
+	return nil
+}
+
+// Reopen closes the file and opens path again, for when something else has moved or removed it
+func (f *rotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+	}
+	return f.open()
+}
+
+// Close closes the file, once rotated files are done being compressed
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending.Wait()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// prune removes the oldest rotated files beyond maxBackups
+func (f *rotatingFile) prune() error {
+	if f.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return err
+	}
+	var rotated []string
+	for _, backup := range backups {
+		// Skip a compression that is still being written
+		if !strings.HasSuffix(backup, ".gz.tmp") {
+			rotated = append(rotated, backup)
+		}
+	}
+	if len(rotated) <= f.maxBackups {
+		return nil
+	}
+	sort.Strings(rotated)
+	for _, old := range rotated[:len(rotated)-f.maxBackups] {
+		if err := os.Remove(old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compress gzips path into path.gz and removes path. The archive is written under a temporary name first,
+// so a half written one is never mistaken for a finished one.
+func compress(path string) (err error) {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	temporary := path + ".gz.tmp"
+	target, err := os.OpenFile(temporary, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = target.Close()
+			_ = os.Remove(temporary)
+		}
+	}()
+
+	archive := gzip.NewWriter(target)
+	if _, err = io.Copy(archive, source); err != nil {
+		return err
+	}
+	if err = archive.Close(); err != nil {
+		return err
+	}
+	if err = target.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(temporary, path+".gz"); err != nil {
+		return err
+	}
+	_ = source.Close()
+	return os.Remove(path)
+}
@@ -2,48 +2,153 @@ package main
 
 import (
 	"bookateriago/account"
+	"bookateriago/admin"
+	"bookateriago/app"
 	"bookateriago/assignment"
 	"bookateriago/auth"
+	"bookateriago/config"
+	"bookateriago/core"
+	"bookateriago/cors"
 	"bookateriago/document"
 	"bookateriago/forum"
+	"bookateriago/health"
+	"bookateriago/i18n"
 	"bookateriago/log"
+	"bookateriago/metrics"
+	"bookateriago/migrations"
+	"bookateriago/requestid"
+	"bookateriago/storage"
+	"bookateriago/tracing"
+	"context"
+	"fmt"
 	"github.com/gorilla/mux"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func main() {
+	os.Exit(run())
+}
+
+// run starts the server, or the migrate subcommand, and returns the exit code once it stopped. Everything it
+// opened is closed by then: the database and Redis pools, and the traces and logs are flushed.
+func run() int {
+	// Refuse to start with a broken configuration instead of failing on the first request that needs it
+	settings, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := log.Setup(settings.Log); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer log.Close()
+	if err := tracing.Setup(settings.Tracing); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer tracing.Close()
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		return runMigrate(settings, os.Args[2:])
+	}
+
+	go reopenLogs()
+
+	a, err := app.New(settings)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer a.Close()
+
+	if settings.Database.AutoMigrate {
+		sqlDB, err := a.DB.DB()
+		if err == nil {
+			_, err = migrations.Up(context.Background(), sqlDB)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
 	router := mux.NewRouter()
+	router.NotFoundHandler = metrics.Unmatched(core.NotFoundHandler())
+	router.MethodNotAllowedHandler = metrics.Unmatched(core.MethodNotAllowedHandler())
+	// Probes for the load balancer, outside of /v1 like the metrics
+	router.HandleFunc("/healthz", health.Liveness).Methods("GET")
+	router.HandleFunc("/readyz", a.Health.Readiness).Methods("GET")
+	if settings.Metrics.Enabled {
+		router.Handle(settings.Metrics.Path, metrics.Handler()).Methods("GET")
+	}
 	// Documentation route
 	fs := http.FileServer(http.Dir("./docs"))
 	router.PathPrefix("/docs/").Handler(http.StripPrefix("/docs/", fs))
+	// Files uploaded to the local storage backend, served through signed URLs only
+	if local, ok := a.Storage.(*storage.Local); ok {
+		router.PathPrefix(local.BaseURL).Handler(http.StripPrefix(local.BaseURL, local))
+	}
 	versionRouter := router.PathPrefix("/v1").Subrouter()
 
-	document.Router(versionRouter.PathPrefix("/document").Subrouter())
-	account.Router(versionRouter.PathPrefix("/account").Subrouter())
-	auth.Router(versionRouter.PathPrefix("/auth").Subrouter())
-	forum.Router(versionRouter.PathPrefix("/forum").Subrouter())
-	assignment.Router(versionRouter.PathPrefix("/assignment").Subrouter())
+	document.Router(versionRouter.PathPrefix("/document").Subrouter(), a)
+	account.Router(versionRouter.PathPrefix("/account").Subrouter(), a)
+	auth.Router(versionRouter.PathPrefix("/auth").Subrouter(), a)
+	forum.Router(versionRouter.PathPrefix("/forum").Subrouter(), a)
+	assignment.Router(versionRouter.PathPrefix("/assignment").Subrouter(), a)
+	admin.Router(versionRouter.PathPrefix("/admin").Subrouter(), a)
 
-	router.Use(corsMiddleware)
+	router.Use(log.Route)
+	router.Use(tracing.Route)
+	router.Use(metrics.Middleware)
+	router.Use(i18n.Middleware)
 
-	log.Start("Starting Server")
-	err := http.ListenAndServe(":5000", router)
-	log.ErrorHandler(err)
+	// SIGTERM, or Ctrl-C, stops the server and the background jobs
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	var jobs sync.WaitGroup
+	jobs.Add(2)
+	// Purge accounts whose deletion grace period has expired
+	go func() {
+		defer jobs.Done()
+		account.StartPurge(ctx, a.DB, time.Hour)
+	}()
+	// Send queued emails
+	go func() {
+		defer jobs.Done()
+		a.Emails.StartWorker(ctx)
+	}()
 
+	// The request ID, access log, trace and CORS headers wrap the router rather than being router middlewares,
+	// so unmatched routes and preflight requests get them too
+	cors.Setup(settings.CORS)
+	handler := requestid.Middleware(log.Middleware(tracing.Middleware(cors.Middleware(router))))
+	err = serve(ctx, settings.Server, handler)
+	// Let the jobs finish what they were doing before their connections close
+	stop()
+	jobs.Wait()
+	if err != nil {
+		log.Error("server stopped", log.Fields{"error": err})
+		return 1
+	}
+	log.Info("server stopped")
+	return 0
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
-		w.Header().Set("Access-Control-Allow-Origin", "http://bookateria.net")
-		w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Authorization")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+// reopenLogs reopens the log files on SIGHUP, so they can be moved aside without restarting the server
+func reopenLogs() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		if err := log.Reopen(); err != nil {
+			log.Error("reopening log files", log.Fields{"error": err})
+			continue
 		}
-		next.ServeHTTP(w, r)
-		return
-	})
+		log.Info("reopened log files")
+	}
 }
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// startKey holds the time a query started in the gorm statement
+const startKey = "metrics:start"
+
+// Database is a gorm plugin timing every query. Add it with db.Use(metrics.Database{}).
+type Database struct{}
+
+// Name identifies the plugin to gorm
+func (Database) Name() string {
+	return "metrics"
+}
+
+// Initialize registers the callbacks around each kind of query
+func (Database) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	processors := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", callbacks.Create().Before("gorm:create").Register, callbacks.Create().After("gorm:create").Register},
+		{"query", callbacks.Query().Before("gorm:query").Register, callbacks.Query().After("gorm:query").Register},
+		{"update", callbacks.Update().Before("gorm:update").Register, callbacks.Update().After("gorm:update").Register},
+		{"delete", callbacks.Delete().Before("gorm:delete").Register, callbacks.Delete().After("gorm:delete").Register},
+		{"row", callbacks.Row().Before("gorm:row").Register, callbacks.Row().After("gorm:row").Register},
+		{"raw", callbacks.Raw().Before("gorm:raw").Register, callbacks.Raw().After("gorm:raw").Register},
+	}
+
+	for _, processor := range processors {
+		operation := processor.operation
+		if err := processor.before("metrics:before_"+operation, startQuery); err != nil {
+			return err
+		}
+		if err := processor.after("metrics:after_"+operation, func(db *gorm.DB) {
+			endQuery(db, operation)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startQuery(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+func endQuery(db *gorm.DB, operation string) {
+	value, ok := db.InstanceGet(startKey)
+	start, isTime := value.(time.Time)
+	if !ok || !isTime {
+		return
+	}
+	table := db.Statement.Table
+	if table == "" {
+		table = "none"
+	}
+
+	dbDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		dbErrors.WithLabelValues(operation, table).Inc()
+	}
+}
+
+// redisStartKey holds the time a Redis command started in its context
+type redisStartKey struct{}
+
+// Redis is a go-redis hook timing every command. Add it with client.AddHook(metrics.Redis{}).
+type Redis struct{}
+
+// BeforeProcess notes when the command started
+func (Redis) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+// AfterProcess times the command
+func (Redis) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	observeRedis(ctx, cmd.Name(), cmd.Err())
+	return nil
+}
+
+// BeforeProcessPipeline notes when the pipeline started
+func (Redis) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+// AfterProcessPipeline times the pipeline as a whole
+func (Redis) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && cmd.Err() != redis.Nil {
+			err = cmd.Err()
+			break
+		}
+	}
+	observeRedis(ctx, "pipeline", err)
+	return nil
+}
+
+func observeRedis(ctx context.Context, command string, err error) {
+	start, ok := ctx.Value(redisStartKey{}).(time.Time)
+	if !ok {
+		return
+	}
+	redisDuration.WithLabelValues(command).Observe(time.Since(start).Seconds())
+	if err != nil && err != redis.Nil {
+		redisErrors.WithLabelValues(command).Inc()
+	}
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// unmatched is the route label of requests that match no route, so unknown paths can't add labels
+const unmatched = "unmatched"
+
+// statusRecorder notes the status a handler answers with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+// Flush lets streaming handlers flush through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Middleware counts and times requests by the template of the route they matched, e.g.
+// /v1/forum/question/{slug}, rather than by path. It is a router middleware.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := unmatched
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		instrument(route, next, w, r)
+	})
+}
+
+// Unmatched counts and times the requests handled by h under the unmatched route. It is for the router's
+// NotFoundHandler and MethodNotAllowedHandler, which router middlewares don't run for.
+func Unmatched(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		instrument(unmatched, h, w, r)
+	})
+}
+
+func instrument(route string, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w}
+	next.ServeHTTP(recorder, r)
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+
+	httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Inc()
+	httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,153 @@
+// Package metrics collects Prometheus metrics on requests, the database, Redis, storage and email,
+// and serves them in the Prometheus text format.
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every metric name
+const namespace = "bookateria"
+
+// registry holds the metrics of this package, and the Go runtime and process ones
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests answered, by route template, method and status.",
+	}, []string{"route", "method", "status"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to answer HTTP requests, by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by database queries, by operation and table.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"operation", "table"})
+	dbErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "Database queries that failed, by operation and table. Records not found don't count.",
+	}, []string{"operation", "table"})
+
+	redisDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_command_duration_seconds",
+		Help:      "Time taken by Redis commands, by command. Pipelines count as one pipeline command.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 14),
+	}, []string{"command"})
+	redisErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redis_command_errors_total",
+		Help:      "Redis commands that failed, by command. Missing keys don't count.",
+	}, []string{"command"})
+
+	uploadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_upload_duration_seconds",
+		Help:      "Time taken to upload files to storage, by driver and result.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"driver", "result"})
+	uploadSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_upload_size_bytes",
+		Help:      "Size of the files uploaded to storage, by driver.",
+		Buckets:   prometheus.ExponentialBuckets(64<<10, 4, 8),
+	}, []string{"driver"})
+
+	emails = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emails_total",
+		Help:      "Emails the worker tried to send, by outcome: sent, retried or dead.",
+	}, []string{"outcome"})
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		dbDuration, dbErrors,
+		redisDuration, redisErrors,
+		uploadDuration, uploadSize,
+		emails,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// TrackUpload times an upload of body to the storage driver. Upload what it returns instead of body, and
+// call done with the outcome. Bodies that can seek are measured up front and returned as they are, so
+// uploaders that read them in parts still can.
+func TrackUpload(driver string, body io.Reader) (tracked io.Reader, done func(err error)) {
+	start := time.Now()
+	size := int64(-1)
+	counter := &countingReader{Reader: body}
+	tracked = counter
+	if seeker, ok := body.(io.Seeker); ok {
+		current, err := seeker.Seek(0, io.SeekCurrent)
+		if end, endErr := seeker.Seek(0, io.SeekEnd); err == nil && endErr == nil {
+			size = end - current
+		}
+		if _, err := seeker.Seek(current, io.SeekStart); err == nil && size >= 0 {
+			tracked = body
+		} else {
+			size = -1
+		}
+	}
+
+	return tracked, func(err error) {
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		uploadDuration.WithLabelValues(driver, result).Observe(time.Since(start).Seconds())
+		if err != nil {
+			return
+		}
+		if size < 0 {
+			size = counter.read
+		}
+		uploadSize.WithLabelValues(driver).Observe(float64(size))
+	}
+}
+
+type countingReader struct {
+	io.Reader
+	read int64
+}
+
+func (c *countingReader) Read(data []byte) (int, error) {
+	n, err := c.Reader.Read(data)
+	c.read += int64(n)
+	return n, err
+}
+
+// EmailSent counts an email the worker sent
+func EmailSent() {
+	emails.WithLabelValues("sent").Inc()
+}
+
+// EmailFailed counts an email the worker couldn't send. dead says it was given up on instead of retried.
+func EmailFailed(dead bool) {
+	if dead {
+		emails.WithLabelValues("dead").Inc()
+		return
+	}
+	emails.WithLabelValues("retried").Inc()
+}
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS submissions;
+DROP TABLE IF EXISTS problems;
+DROP TABLE IF EXISTS answer_upvotes;
+DROP TABLE IF EXISTS question_up_votes;
+DROP TABLE IF EXISTS answers;
+DROP TABLE IF EXISTS question_tags;
+DROP TABLE IF EXISTS questions;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS documents;
+DROP TABLE IF EXISTS profiles;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,166 @@
+-- Schema as it was created by AutoMigrate. Everything is IF NOT EXISTS so databases
+-- that were set up before migrations existed are adopted, with the constraints AutoMigrate
+-- missed added at the end.
+
+CREATE TABLE IF NOT EXISTS users (
+    id                bigserial PRIMARY KEY,
+    user_name         text,
+    full_name         text NOT NULL,
+    alias             text,
+    email             text NOT NULL UNIQUE,
+    is_admin          boolean DEFAULT false,
+    password          text,
+    last_login        timestamptz,
+    is_active         boolean DEFAULT false,
+    is_email_verified boolean DEFAULT false,
+    language          text DEFAULT 'en',
+    created_at        timestamptz,
+    updated_at        timestamptz,
+    deleted_at        timestamptz,
+    purged_at         timestamptz
+);
+
+-- Added to users shortly before migrations, older databases may not have them yet
+ALTER TABLE users ADD COLUMN IF NOT EXISTS language text DEFAULT 'en';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS purged_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS profiles (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    points     bigint DEFAULT 20,
+    user_id    bigint NOT NULL UNIQUE CONSTRAINT fk_profiles_user REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS documents (
+    id          bigserial PRIMARY KEY,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    size        decimal,
+    downloads   bigint,
+    title       text NOT NULL,
+    edition     bigint DEFAULT 0,
+    author      text,
+    summary     text,
+    file_slug   text,
+    slug        text,
+    cover_slug  text,
+    uploader_id bigint CONSTRAINT fk_documents_uploader REFERENCES users (id)
+);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id          bigserial PRIMARY KEY,
+    document_id bigint CONSTRAINT fk_documents_tags REFERENCES documents (id),
+    tag_name    text,
+    slug        text
+);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id            bigserial PRIMARY KEY,
+    document_id   bigint CONSTRAINT fk_documents_category REFERENCES documents (id),
+    category_name text,
+    slug          text
+);
+
+CREATE TABLE IF NOT EXISTS questions (
+    id          bigserial PRIMARY KEY,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    title       text,
+    description text,
+    user_id     bigint CONSTRAINT fk_questions_user REFERENCES users (id),
+    slug        text
+);
+
+CREATE TABLE IF NOT EXISTS question_tags (
+    id          bigserial PRIMARY KEY,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    question_id bigint CONSTRAINT fk_questions_question_tags REFERENCES questions (id),
+    name        text,
+    slug        text
+);
+
+CREATE TABLE IF NOT EXISTS answers (
+    id          bigserial PRIMARY KEY,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    question_id bigint CONSTRAINT fk_answers_question REFERENCES questions (id),
+    response    text,
+    user_id     bigint CONSTRAINT fk_answers_user REFERENCES users (id) ON DELETE SET NULL,
+    slug        text
+);
+
+CREATE TABLE IF NOT EXISTS question_up_votes (
+    id          bigserial PRIMARY KEY,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    question_id bigint CONSTRAINT fk_question_up_votes_question REFERENCES questions (id),
+    user_id     bigint CONSTRAINT fk_question_up_votes_user REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS answer_upvotes (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    answer_id  bigint CONSTRAINT fk_answer_upvotes_answer REFERENCES answers (id),
+    user_id    bigint CONSTRAINT fk_answer_upvotes_user REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS problems (
+    id               bigserial PRIMARY KEY,
+    created_at       timestamptz,
+    updated_at       timestamptz,
+    title            text,
+    description      text,
+    deadline         timestamptz,
+    user_id          bigint CONSTRAINT fk_problems_user REFERENCES users (id),
+    slug             text,
+    submission_count bigint
+);
+
+CREATE TABLE IF NOT EXISTS submissions (
+    id          bigserial PRIMARY KEY,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    problem_id  bigint CONSTRAINT fk_submissions_problem REFERENCES problems (id),
+    user_id     bigint CONSTRAINT fk_submissions_user REFERENCES users (id),
+    file_slug   text,
+    slug        text,
+    submissions bigint
+);
+
+-- AutoMigrate never created the ON DELETE actions or the profile constraints above, the models spell their
+-- tag "constraints". Adopted databases get them here, so users can be deleted; on new ones they are
+-- dropped and added again unchanged.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM profiles WHERE user_id IS NULL)
+        OR EXISTS (SELECT 1 FROM profiles GROUP BY user_id HAVING count(*) > 1) THEN
+        RAISE EXCEPTION 'profiles without a user, or more than one for a user, block the profile constraints'
+            USING HINT = 'Check them, then remove the ones to go, e.g. DELETE FROM profiles WHERE user_id IS NULL; '
+                'DELETE FROM profiles WHERE id NOT IN (SELECT min(id) FROM profiles GROUP BY user_id);';
+    END IF;
+END
+$$;
+ALTER TABLE profiles ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE profiles DROP CONSTRAINT IF EXISTS profiles_user_id_key;
+ALTER TABLE profiles ADD CONSTRAINT profiles_user_id_key UNIQUE (user_id);
+
+ALTER TABLE profiles DROP CONSTRAINT IF EXISTS fk_profiles_user;
+ALTER TABLE profiles ADD CONSTRAINT fk_profiles_user
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+ALTER TABLE answers DROP CONSTRAINT IF EXISTS fk_answers_user;
+ALTER TABLE answers ADD CONSTRAINT fk_answers_user
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
+
+ALTER TABLE question_up_votes DROP CONSTRAINT IF EXISTS fk_question_up_votes_user;
+ALTER TABLE question_up_votes ADD CONSTRAINT fk_question_up_votes_user
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+ALTER TABLE answer_upvotes DROP CONSTRAINT IF EXISTS fk_answer_upvotes_user;
+ALTER TABLE answer_upvotes ADD CONSTRAINT fk_answer_upvotes_user
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS slug_history;
+DROP INDEX IF EXISTS submissions_slug_key;
+DROP INDEX IF EXISTS problems_slug_key;
+DROP INDEX IF EXISTS answers_slug_key;
+DROP INDEX IF EXISTS questions_slug_key;
+DROP INDEX IF EXISTS documents_slug_key;
@@ -0,0 +1,37 @@
+-- Slugs become unique per table. Rows that never got one, or that share one with an older row, are
+-- given their id as a suffix first so the indexes can be built.
+UPDATE documents SET slug = 'document-' || id WHERE slug IS NULL OR slug = '';
+UPDATE documents d SET slug = d.slug || '-' || d.id
+    WHERE EXISTS (SELECT 1 FROM documents o WHERE o.slug = d.slug AND o.id < d.id);
+CREATE UNIQUE INDEX IF NOT EXISTS documents_slug_key ON documents (slug);
+
+UPDATE questions SET slug = 'question-' || id WHERE slug IS NULL OR slug = '';
+UPDATE questions q SET slug = q.slug || '-' || q.id
+    WHERE EXISTS (SELECT 1 FROM questions o WHERE o.slug = q.slug AND o.id < q.id);
+CREATE UNIQUE INDEX IF NOT EXISTS questions_slug_key ON questions (slug);
+
+UPDATE answers SET slug = 'answer-' || id WHERE slug IS NULL OR slug = '';
+UPDATE answers a SET slug = a.slug || '-' || a.id
+    WHERE EXISTS (SELECT 1 FROM answers o WHERE o.slug = a.slug AND o.id < a.id);
+CREATE UNIQUE INDEX IF NOT EXISTS answers_slug_key ON answers (slug);
+
+UPDATE problems SET slug = 'problem-' || id WHERE slug IS NULL OR slug = '';
+UPDATE problems p SET slug = p.slug || '-' || p.id
+    WHERE EXISTS (SELECT 1 FROM problems o WHERE o.slug = p.slug AND o.id < p.id);
+CREATE UNIQUE INDEX IF NOT EXISTS problems_slug_key ON problems (slug);
+
+UPDATE submissions SET slug = 'submission-' || id WHERE slug IS NULL OR slug = '';
+UPDATE submissions s SET slug = s.slug || '-' || s.id
+    WHERE EXISTS (SELECT 1 FROM submissions o WHERE o.slug = s.slug AND o.id < s.id);
+CREATE UNIQUE INDEX IF NOT EXISTS submissions_slug_key ON submissions (slug);
+
+-- Slugs a row had before it was renamed, so links to them can be redirected to the current one
+CREATE TABLE IF NOT EXISTS slug_history (
+    id         bigserial PRIMARY KEY,
+    model      text NOT NULL,
+    slug       text NOT NULL,
+    entity_id  bigint NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (model, slug)
+);
+CREATE INDEX IF NOT EXISTS idx_slug_history_entity ON slug_history (model, entity_id);
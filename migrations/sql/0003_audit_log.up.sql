@@ -0,0 +1,29 @@
+-- Every create, update and delete of content and accounts. Entries are never changed or removed, so they
+-- can't hold personal data the purge of an account would have to get out: actors are kept by ID only,
+-- and the application redacts emails, names and passwords from the changes before writing them.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          bigserial PRIMARY KEY,
+    actor_id    bigint,
+    action      text NOT NULL,
+    entity_type text NOT NULL,
+    entity_id   bigint NOT NULL,
+    changes     jsonb NOT NULL DEFAULT '{}',
+    ip          text NOT NULL DEFAULT '',
+    request_id  text NOT NULL DEFAULT '',
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log (entity_type, entity_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at);
+
+-- The log is append-only, even for the application's own database user
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE PROCEDURE audit_log_append_only();
@@ -0,0 +1,2 @@
+-- The keys stay keys: the URLs they were cut from name a bucket and host the database doesn't know.
+SELECT 1;
@@ -0,0 +1,3 @@
+-- Files are private now, so file_slug holds the storage key instead of the public S3 URL
+UPDATE documents SET file_slug = regexp_replace(file_slug, '^https?://[^/]+/', '') WHERE file_slug LIKE 'http%';
+UPDATE submissions SET file_slug = regexp_replace(file_slug, '^https?://[^/]+/', '') WHERE file_slug LIKE 'http%';
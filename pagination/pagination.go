@@ -0,0 +1,289 @@
+package pagination
+
+import (
+	"bookateriago/core"
+	"bookateriago/log"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultSize is the page size when page_size isn't given
+	DefaultSize = 10
+	// MaxSize is the largest page size. Anything bigger is cut down to it
+	MaxSize = 50
+)
+
+// Params is how a request wants its list paginated. Offset mode uses ?page=N, keyset mode
+// is picked by sending ?cursor= (empty for the first page), and both take ?page_size=N.
+type Params struct {
+	Page     int
+	PageSize int
+	// Keyset is true in keyset mode. After and Before are the ID the page starts after or ends before,
+	// 0 on the first page.
+	Keyset bool
+	After  uint64
+	Before uint64
+}
+
+// Page is the body of every list response
+type Page struct {
+	Previous bool   `json:"previous"`
+	Next     bool   `json:"next"`
+	Page     int    `json:"page,omitempty"`
+	PageSize int    `json:"page_size"`
+	Count    *int64 `json:"count,omitempty"`
+	// Cursors for the pages around this one, in keyset mode only
+	PreviousCursor string      `json:"previous_cursor,omitempty"`
+	NextCursor     string      `json:"next_cursor,omitempty"`
+	Result         interface{} `json:"result"`
+
+	keyset bool
+	last   int
+}
+
+// Parse reads the pagination parameters of the request. Invalid values come back as field errors.
+func Parse(r *http.Request) (Params, []core.FieldError) {
+	query := r.URL.Query()
+	params := Params{Page: 1, PageSize: DefaultSize}
+	var invalid []core.FieldError
+
+	if size := query.Get("page_size"); size != "" {
+		pageSize, err := strconv.Atoi(size)
+		switch {
+		case err != nil || pageSize < 1:
+			invalid = append(invalid, core.Field("page_size", "invalid"))
+		case pageSize > MaxSize:
+			params.PageSize = MaxSize
+		default:
+			params.PageSize = pageSize
+		}
+	}
+
+	if _, ok := query["cursor"]; ok {
+		params.Keyset = true
+		if cursor := query.Get("cursor"); cursor != "" {
+			var ok bool
+			params.After, params.Before, ok = decodeCursor(cursor)
+			if !ok {
+				invalid = append(invalid, core.Field("cursor", "invalid"))
+			}
+		}
+	} else if page := query.Get("page"); page != "" {
+		number, err := strconv.Atoi(page)
+		if err != nil || number < 1 {
+			invalid = append(invalid, core.Field("page", "invalid"))
+		} else {
+			params.Page = number
+		}
+	}
+	return params, invalid
+}
+
+// List answers the request with the page of query it asked for. query and dest are as for Find.
+func List(w http.ResponseWriter, r *http.Request, query *gorm.DB, dest interface{}) {
+	params, invalid := Parse(r)
+	if len(invalid) > 0 {
+		core.WriteProblem(w, r, core.FourHundred, invalid...)
+		return
+	}
+
+	page, err := Find(query, params, dest)
+	if err != nil {
+		log.ErrorContext(r.Context(), err)
+		core.WriteProblem(w, r, core.FiveHundred)
+		return
+	}
+	Write(w, r, page)
+}
+
+// Find loads the page of query described by params into dest, a pointer to a slice of models with an ID field.
+// Rows are ordered by id so pages are stable. The count, in offset mode, is a COUNT over the same conditions.
+func Find(query *gorm.DB, params Params, dest interface{}) (Page, error) {
+	query = query.Session(&gorm.Session{WithConditions: true})
+	page := Page{PageSize: params.PageSize, Result: dest}
+
+	if !params.Keyset {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return page, err
+		}
+		err := query.Order("id").Offset((params.Page - 1) * params.PageSize).Limit(params.PageSize).Find(dest).Error
+		page.Page = params.Page
+		page.Count = &count
+		page.Previous = params.Page > 1
+		page.Next = int64(params.Page*params.PageSize) < count
+		page.last = int((count + int64(params.PageSize) - 1) / int64(params.PageSize))
+		return page, err
+	}
+
+	// One extra row tells if there is anything past this page
+	page.keyset = true
+	var err error
+	if params.Before != 0 {
+		err = query.Where("id < ?", params.Before).Order("id DESC").Limit(params.PageSize + 1).Find(dest).Error
+		reverse(dest)
+	} else {
+		err = query.Where("id > ?", params.After).Order("id").Limit(params.PageSize + 1).Find(dest).Error
+	}
+	if err != nil {
+		return page, err
+	}
+
+	rows := reflect.ValueOf(dest).Elem()
+	more := rows.Len() > params.PageSize
+	if more {
+		// The extra row is on the far end from where the page started
+		if params.Before != 0 {
+			rows.Set(rows.Slice(1, rows.Len()))
+		} else {
+			rows.Set(rows.Slice(0, params.PageSize))
+		}
+	}
+
+	if params.Before != 0 {
+		page.Previous, page.Next = more, true
+	} else {
+		page.Previous, page.Next = params.After != 0, more
+	}
+	if rows.Len() > 0 {
+		if page.Previous {
+			page.PreviousCursor = encodeCursor("b", id(rows.Index(0)))
+		}
+		if page.Next {
+			page.NextCursor = encodeCursor("a", id(rows.Index(rows.Len()-1)))
+		}
+	}
+	return page, nil
+}
+
+// Slice is Find for lists that are already in memory, like the ones kept in Redis. Only offset mode is supported,
+// a cursor gets the first page.
+func Slice(params Params, length int) (start, end int, page Page) {
+	count := int64(length)
+	if params.Keyset {
+		params.Page = 1
+	}
+	start = (params.Page - 1) * params.PageSize
+	if start > length {
+		start = length
+	}
+	end = start + params.PageSize
+	if end > length {
+		end = length
+	}
+
+	page = Page{
+		Page:     params.Page,
+		PageSize: params.PageSize,
+		Count:    &count,
+		Previous: params.Page > 1,
+		Next:     end < length,
+		last:     (length + params.PageSize - 1) / params.PageSize,
+	}
+	return start, end, page
+}
+
+// Write sends the page along with a Link header (RFC 8288) pointing at the pages around it
+func Write(w http.ResponseWriter, r *http.Request, page Page) {
+	if links := page.links(r); len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(page)
+	log.ErrorContext(r.Context(), err)
+}
+
+// links builds the Link header values for the page, relative to the request URL
+func (p Page) links(r *http.Request) []string {
+	link := func(rel string, set map[string]string) string {
+		query := r.URL.Query()
+		query.Del("page")
+		query.Del("cursor")
+		query.Set("page_size", strconv.Itoa(p.PageSize))
+		for key, value := range set {
+			query.Set(key, value)
+		}
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, query.Encode(), rel)
+	}
+
+	var links []string
+	if p.keyset {
+		links = append(links, link("first", map[string]string{"cursor": ""}))
+		if p.PreviousCursor != "" {
+			links = append(links, link("prev", map[string]string{"cursor": p.PreviousCursor}))
+		}
+		if p.NextCursor != "" {
+			links = append(links, link("next", map[string]string{"cursor": p.NextCursor}))
+		}
+		return links
+	}
+
+	links = append(links, link("first", map[string]string{"page": "1"}))
+	if p.Previous {
+		links = append(links, link("prev", map[string]string{"page": strconv.Itoa(p.Page - 1)}))
+	}
+	if p.Next {
+		links = append(links, link("next", map[string]string{"page": strconv.Itoa(p.Page + 1)}))
+	}
+	if p.last > 0 {
+		links = append(links, link("last", map[string]string{"page": strconv.Itoa(p.last)}))
+	}
+	return links
+}
+
+// encodeCursor makes an opaque cursor out of the direction, "a" for after or "b" for before, and the ID
+func encodeCursor(direction string, id uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(direction + strconv.FormatUint(id, 10)))
+}
+
+func decodeCursor(cursor string) (after, before uint64, ok bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) < 2 {
+		return 0, 0, false
+	}
+	id, err := strconv.ParseUint(string(raw[1:]), 10, 64)
+	if err != nil || id == 0 {
+		return 0, 0, false
+	}
+	switch raw[0] {
+	case 'a':
+		return id, 0, true
+	case 'b':
+		return 0, id, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// id reads the ID field of a model
+func id(row reflect.Value) uint64 {
+	for row.Kind() == reflect.Ptr {
+		row = row.Elem()
+	}
+	field := row.FieldByName("ID")
+	switch field.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return field.Uint()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(field.Int())
+	default:
+		return 0
+	}
+}
+
+// reverse flips the slice dest points to in place
+func reverse(dest interface{}) {
+	rows := reflect.ValueOf(dest).Elem()
+	swap := reflect.Swapper(rows.Interface())
+	for i, j := 0, rows.Len()-1; i < j; i, j = i+1, j-1 {
+		swap(i, j)
+	}
+}
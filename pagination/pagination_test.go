@@ -0,0 +1,147 @@
+package pagination
+
+import (
+	"bookateriago/core"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	tests := []struct {
+		direction string
+		id        uint64
+		after     uint64
+		before    uint64
+	}{
+		{"a", 1, 1, 0},
+		{"a", 18446744073709551615, 18446744073709551615, 0},
+		{"b", 42, 0, 42},
+	}
+
+	for _, test := range tests {
+		cursor := encodeCursor(test.direction, test.id)
+		after, before, ok := decodeCursor(cursor)
+		if !ok || after != test.after || before != test.before {
+			t.Errorf("decodeCursor(encodeCursor(%q, %d)) = %d, %d, %v", test.direction, test.id, after, before, ok)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "!!!"},
+		{"too short", encodeCursor("a", 0)[:1]},
+		{"no ID", "YQ"},
+		{"zero ID", encodeCursor("a", 0)},
+		{"not a number", "YXh5eg"},
+		{"unknown direction", encodeCursor("c", 7)},
+		{"padded", encodeCursor("a", 7) + "="},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if after, before, ok := decodeCursor(test.cursor); ok {
+				t.Errorf("decodeCursor(%q) = %d, %d, true, want it refused", test.cursor, after, before)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query   string
+		params  Params
+		invalid []core.FieldError
+	}{
+		{"", Params{Page: 1, PageSize: DefaultSize}, nil},
+		{"page=3&page_size=20", Params{Page: 3, PageSize: 20}, nil},
+		{"page_size=1000", Params{Page: 1, PageSize: MaxSize}, nil},
+		{"page=0&page_size=-1", Params{Page: 1, PageSize: DefaultSize},
+			[]core.FieldError{core.Field("page_size", "invalid"), core.Field("page", "invalid")}},
+		{"page=two", Params{Page: 1, PageSize: DefaultSize}, []core.FieldError{core.Field("page", "invalid")}},
+		{"cursor=", Params{Page: 1, PageSize: DefaultSize, Keyset: true}, nil},
+		{"cursor=" + encodeCursor("a", 5) + "&page=4", Params{Page: 1, PageSize: DefaultSize, Keyset: true, After: 5}, nil},
+		{"cursor=" + encodeCursor("b", 5), Params{Page: 1, PageSize: DefaultSize, Keyset: true, Before: 5}, nil},
+		{"cursor=nonsense", Params{Page: 1, PageSize: DefaultSize, Keyset: true},
+			[]core.FieldError{core.Field("cursor", "invalid")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			params, invalid := Parse(httptest.NewRequest("GET", "/documents?"+test.query, nil))
+			if params != test.params {
+				t.Errorf("params %+v, want %+v", params, test.params)
+			}
+			if !reflect.DeepEqual(invalid, test.invalid) {
+				t.Errorf("invalid %v, want %v", invalid, test.invalid)
+			}
+		})
+	}
+}
+
+func TestSlice(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   Params
+		length   int
+		start    int
+		end      int
+		previous bool
+		next     bool
+		last     int
+	}{
+		{"first page", Params{Page: 1, PageSize: 10}, 25, 0, 10, false, true, 3},
+		{"last page", Params{Page: 3, PageSize: 10}, 25, 20, 25, true, false, 3},
+		{"past the end", Params{Page: 5, PageSize: 10}, 25, 25, 25, true, false, 3},
+		{"empty", Params{Page: 1, PageSize: 10}, 0, 0, 0, false, false, 0},
+		{"cursor gets the first page", Params{Page: 4, PageSize: 10, Keyset: true, After: 9}, 25, 0, 10, false, true, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end, page := Slice(test.params, test.length)
+			if start != test.start || end != test.end {
+				t.Errorf("Slice() = %d:%d, want %d:%d", start, end, test.start, test.end)
+			}
+			if page.Previous != test.previous || page.Next != test.next || page.last != test.last {
+				t.Errorf("previous %v, next %v, last %d, want %v, %v, %d",
+					page.Previous, page.Next, page.last, test.previous, test.next, test.last)
+			}
+			if page.Count == nil || *page.Count != int64(test.length) {
+				t.Errorf("count %v, want %d", page.Count, test.length)
+			}
+		})
+	}
+}
+
+func TestLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		page Page
+		want []string
+	}{
+		{"offset", Page{Page: 2, PageSize: 10, Previous: true, Next: true, last: 3}, []string{
+			`</documents?page=1&page_size=10&sort=title>; rel="first"`,
+			`</documents?page=1&page_size=10&sort=title>; rel="prev"`,
+			`</documents?page=3&page_size=10&sort=title>; rel="next"`,
+			`</documents?page=3&page_size=10&sort=title>; rel="last"`,
+		}},
+		{"keyset", Page{PageSize: 10, keyset: true, NextCursor: "YTk"}, []string{
+			`</documents?cursor=&page_size=10&sort=title>; rel="first"`,
+			`</documents?cursor=YTk&page_size=10&sort=title>; rel="next"`,
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/documents?page=2&cursor=x&sort=title", nil)
+			if links := test.page.links(r); !reflect.DeepEqual(links, test.want) {
+				t.Errorf("links() = %q, want %q", links, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+)
+
+// Header carries the request ID in both directions. A client or proxy can set it to follow a request through the logs.
+const Header = "X-Request-ID"
+
+type contextKey struct{}
+
+// valid IDs passed in by clients. Anything else is replaced, so the logs can't be filled with junk.
+var valid = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Middleware gives every request an ID, taken from the X-Request-ID header when it has a sensible one.
+// The ID is sent back in the same header and stored in the request context.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid.MatchString(id) {
+			id = New()
+		}
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, id)))
+	})
+}
+
+// New generates a random request ID
+func New() string {
+	buffer := make([]byte, 16)
+	_, _ = rand.Read(buffer)
+	return hex.EncodeToString(buffer)
+}
+
+// FromContext returns the ID set by Middleware, or an empty string outside of a request
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bookateriago/config"
+	"bookateriago/log"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	stdlog "log"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// selfSignedValidity is how long a generated self-signed certificate is valid
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// serve runs handler on the address of the settings until ctx is cancelled, then stops taking new connections
+// and gives the requests in flight the shutdown timeout to finish. It returns when they did or the timeout ran
+// out; the error is why the server couldn't start or stop cleanly.
+func serve(ctx context.Context, settings config.ServerConfig, handler http.Handler) error {
+	server := &http.Server{
+		Addr:              settings.Address,
+		Handler:           handler,
+		ReadTimeout:       settings.ReadTimeout,
+		ReadHeaderTimeout: settings.ReadHeaderTimeout,
+		WriteTimeout:      settings.WriteTimeout,
+		IdleTimeout:       settings.IdleTimeout,
+		ErrorLog:          stdlog.New(serverErrors{}, "", 0),
+	}
+	servers := []*http.Server{server}
+
+	var certFile, keyFile string
+	switch settings.TLS.Mode {
+	case "files":
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		certFile, keyFile = settings.TLS.CertFile, settings.TLS.KeyFile
+	case "acme":
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(settings.TLS.CacheDir),
+			HostPolicy: autocert.HostWhitelist(settings.TLS.Domains...),
+			Email:      settings.TLS.Email,
+		}
+		if settings.TLS.Directory != "" {
+			manager.Client = &acme.Client{DirectoryURL: settings.TLS.Directory}
+		}
+		server.TLSConfig = manager.TLSConfig()
+		server.TLSConfig.MinVersion = tls.VersionTLS12
+		if settings.TLS.RedirectAddress != "" {
+			// Answers HTTP-01 challenges, and redirects everything else to HTTPS
+			servers = append(servers, &http.Server{
+				Addr:              settings.TLS.RedirectAddress,
+				Handler:           manager.HTTPHandler(nil),
+				ReadHeaderTimeout: settings.ReadHeaderTimeout,
+				IdleTimeout:       settings.IdleTimeout,
+				ErrorLog:          server.ErrorLog,
+			})
+		}
+	case "self-signed":
+		certificate, err := selfSigned(settings.TLS.Domains)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{certificate}}
+	}
+
+	failed := make(chan error, len(servers))
+	for _, s := range servers {
+		go func(s *http.Server) {
+			var err error
+			if s.TLSConfig != nil {
+				err = s.ListenAndServeTLS(certFile, keyFile)
+			} else {
+				err = s.ListenAndServe()
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				failed <- err
+			}
+		}(s)
+	}
+	log.Info("starting server", log.Fields{"address": settings.Address, "tls": settings.TLS.Mode})
+
+	var err error
+	select {
+	case err = <-failed:
+	case <-ctx.Done():
+		log.Info("shutting down server", log.Fields{"timeout": settings.ShutdownTimeout.String()})
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), settings.ShutdownTimeout)
+	defer cancel()
+	for _, s := range servers {
+		if shutdownErr := s.Shutdown(shutdownCtx); shutdownErr != nil {
+			// Cut the connections of the requests that didn't finish in time
+			s.Close()
+			if err == nil {
+				err = shutdownErr
+			}
+		}
+	}
+	return err
+}
+
+// selfSigned generates a certificate for domains, localhost when there are none. Browsers warn about it,
+// it is meant for local development only.
+func selfSigned(domains []string) (tls.Certificate, error) {
+	if len(domains) == 0 {
+		domains = []string{"localhost", "127.0.0.1", "::1"}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Bookateria"}, CommonName: domains[0]},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, domain := range domains {
+		if ip := net.ParseIP(domain); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, domain)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// serverErrors sends what net/http logs, like failed TLS handshakes, to the application log
+type serverErrors struct{}
+
+func (serverErrors) Write(line []byte) (int, error) {
+	log.Warn("http server", log.Fields{"error": strings.TrimSpace(string(line))})
+	return len(line), nil
+}
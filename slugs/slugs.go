@@ -0,0 +1,220 @@
+// Package slugs gives rows readable, unique slugs and remembers the ones they had before, so old links
+// keep working. Uniqueness is up to the database: every table with slugs has a unique index on them, and
+// a slug that loses the race to another request is retried with the next free number.
+package slugs
+
+import (
+	"bookateriago/log"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgconn"
+	"gorm.io/gorm"
+)
+
+// attempts is how many slugs are tried before giving up
+const attempts = 5
+
+// models are the tables that have slugs, with the word used when a title has nothing to make a slug from
+var models = map[string]string{
+	"documents":   "document",
+	"questions":   "question",
+	"answers":     "answer",
+	"problems":    "problem",
+	"submissions": "submission",
+}
+
+// ErrTaken is returned when every slug tried was taken by the time it was saved
+var ErrTaken = errors.New("slugs: no free slug")
+
+// history is a slug a row had before it was renamed
+type history struct {
+	ID        uint
+	Model     string
+	Slug      string
+	EntityID  uint
+	CreatedAt time.Time
+}
+
+func (history) TableName() string {
+	return "slug_history"
+}
+
+// Create saves a new row of model in db with a slug made from text. save is called with the slug to store and a
+// transaction to store it in, and may be called again with another slug when the first one was taken.
+func Create(ctx context.Context, db *gorm.DB, model, text string, save func(tx *gorm.DB, slug string) error) error {
+	base := base(model, text)
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		_, err := claim(tx, model, base, 0, save)
+		return err
+	})
+}
+
+// Update saves the row of model with the given id, changing its slug when the current one no longer fits
+// text. The current slug is then kept in the history, so Redirects can send its links to the new one.
+func Update(ctx context.Context, db *gorm.DB, model string, id uint, current, text string, save func(tx *gorm.DB, slug string) error) error {
+	base := base(model, text)
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if fits(current, base) {
+			return save(tx, current)
+		}
+
+		slug, err := claim(tx, model, base, id, save)
+		if err != nil {
+			return err
+		}
+
+		// A row renamed back to a slug it had before takes it out of the history again
+		if err := tx.Where("model = ? AND slug = ?", model, slug).Delete(&history{}).Error; err != nil {
+			return err
+		}
+		if current == "" {
+			return nil
+		}
+		return tx.Create(&history{Model: model, Slug: current, EntityID: id}).Error
+	})
+}
+
+// Current looks slug up in the history of model and returns the slug the row goes by now
+func Current(ctx context.Context, db *gorm.DB, model, slug string) (string, bool) {
+	db = db.WithContext(ctx)
+	var old history
+	if err := db.Where("model = ? AND slug = ?", model, slug).Take(&old).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.ErrorHandler(err)
+		}
+		return "", false
+	}
+
+	var current []string
+	db.Table(model).Where("id = ?", old.EntityID).Pluck("slug", &current)
+	if len(current) == 0 || current[0] == "" {
+		return "", false
+	}
+	return current[0], true
+}
+
+// Redirects sends GET requests for an old slug of model, found in the route variable, to the same URL
+// with the current slug, with a 301 so clients and search engines update their links
+func Redirects(db *gorm.DB, model, variable string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			slug, ok := mux.Vars(r)[variable]
+			if !ok || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			current, found := Current(r.Context(), db, model, slug)
+			if !found {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			target := *r.URL
+			target.Path = replaceSegment(r.URL.Path, slug, current)
+			target.RawPath = ""
+			http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+		})
+	}
+}
+
+// base is the slug made from text, or the name of the model when text has nothing to make one from
+func base(model, text string) string {
+	name, ok := models[model]
+	if !ok {
+		panic("slugs: unknown model " + strconv.Quote(model))
+	}
+	if slug := Make(text); slug != "" {
+		return slug
+	}
+	return name
+}
+
+// claim saves the row under the first free slug made from base: base itself, then base-2, base-3 and so on.
+// Each attempt runs in a savepoint, so a slug taken in the meantime only undoes that attempt.
+func claim(tx *gorm.DB, model, base string, id uint, save func(tx *gorm.DB, slug string) error) (string, error) {
+	for attempt := 0; attempt < attempts; attempt++ {
+		slug := base
+		if number, err := free(tx, model, base, id); err != nil {
+			return "", err
+		} else if number > 1 {
+			slug = base + "-" + strconv.Itoa(number)
+		}
+
+		err := tx.Transaction(func(savepoint *gorm.DB) error {
+			return save(savepoint, slug)
+		})
+		if err == nil {
+			return slug, nil
+		}
+		if !taken(err, model) {
+			return "", err
+		}
+	}
+	return "", ErrTaken
+}
+
+// free is the first number that can go after base without clashing with the slugs other rows of model have,
+// or had. 1 means base is free as it is.
+func free(tx *gorm.DB, model, base string, id uint) (int, error) {
+	pattern := "^" + base + "(-[0-9]+)?$"
+	var used []string
+	err := tx.Raw(
+		fmt.Sprintf("SELECT slug FROM %s WHERE id <> ? AND slug ~ ? "+
+			"UNION SELECT slug FROM slug_history WHERE model = ? AND entity_id <> ? AND slug ~ ?", model),
+		id, pattern, model, id, pattern,
+	).Scan(&used).Error
+	if err != nil {
+		return 0, err
+	}
+
+	number := 0
+	for _, slug := range used {
+		n := 1
+		if suffix := strings.TrimPrefix(slug, base); suffix != "" {
+			n, _ = strconv.Atoi(suffix[1:])
+		}
+		if n > number {
+			number = n
+		}
+	}
+	return number + 1, nil
+}
+
+// fits tells if slug was made from base, with or without a number after it
+func fits(slug, base string) bool {
+	if slug == base {
+		return true
+	}
+	suffix := strings.TrimPrefix(slug, base+"-")
+	if suffix == slug || suffix == "" {
+		return false
+	}
+	_, err := strconv.Atoi(suffix)
+	return err == nil
+}
+
+// taken tells if err is the unique index on the slugs of model turning a slug down
+func taken(err error, model string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == model+"_slug_key"
+}
+
+// replaceSegment swaps the path segment that is old for current
+func replaceSegment(path, old, current string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment == old {
+			segments[i] = current
+			break
+		}
+	}
+	return strings.Join(segments, "/")
+}
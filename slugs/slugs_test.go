@@ -0,0 +1,99 @@
+package slugs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestBase(t *testing.T) {
+	tests := []struct {
+		model string
+		text  string
+		want  string
+	}{
+		{"questions", "How do goroutines work?", "how-do-goroutines-work"},
+		{"questions", "???", "question"},
+		{"documents", "", "document"},
+	}
+
+	for _, test := range tests {
+		if got := base(test.model, test.text); got != test.want {
+			t.Errorf("base(%q, %q) = %q, want %q", test.model, test.text, got, test.want)
+		}
+	}
+}
+
+func TestFits(t *testing.T) {
+	tests := []struct {
+		slug string
+		base string
+		want bool
+	}{
+		{"go-book", "go-book", true},
+		{"go-book-2", "go-book", true},
+		{"go-book-12", "go-book", true},
+		{"go-book-", "go-book", false},
+		{"go-book-two", "go-book", false},
+		{"go-books", "go-book", false},
+		{"go", "go-book", false},
+	}
+
+	for _, test := range tests {
+		if got := fits(test.slug, test.base); got != test.want {
+			t.Errorf("fits(%q, %q) = %v, want %v", test.slug, test.base, got, test.want)
+		}
+	}
+}
+
+func TestReplaceSegment(t *testing.T) {
+	tests := []struct {
+		path    string
+		old     string
+		current string
+		want    string
+	}{
+		{"/v1/forum/question/old-title", "old-title", "new-title", "/v1/forum/question/new-title"},
+		{"/v1/forum/old/answer/old", "old", "new", "/v1/forum/new/answer/old"},
+		{"/v1/forum/question/old-title-2", "old-title", "new-title", "/v1/forum/question/old-title-2"},
+	}
+
+	for _, test := range tests {
+		if got := replaceSegment(test.path, test.old, test.current); got != test.want {
+			t.Errorf("replaceSegment(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestUpdateKeepsSlugInTransaction(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The save, and whatever the caller records with it, commits or rolls back as one even when the slug stays
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "questions"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = Update(context.Background(), db, "questions", 3, "old-title-2", "Old title", func(tx *gorm.DB, slug string) error {
+		if slug != "old-title-2" {
+			t.Errorf("saved under %q, want old-title-2", slug)
+		}
+		return tx.Exec(`UPDATE "questions" SET slug = ? WHERE id = ?`, slug, 3).Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,109 @@
+package slugs
+
+import "strings"
+
+// maxLength keeps slugs readable in a URL. Longer ones are cut at a dash.
+const maxLength = 80
+
+// letters lists, for each ASCII spelling, the letters that are written with it. Accented Latin letters lose
+// their accents, Greek and Cyrillic letters are spelled out the way they are usually romanized, and the
+// Cyrillic hard and soft signs are left out.
+var letters = map[string]string{
+	"a":    "àáâãäåāăąǎǻαάаⓐ",
+	"b":    "ƀβбⓑ",
+	"c":    "çćĉċčⓒ",
+	"d":    "ďđðδдⓓ",
+	"e":    "èéêëēĕėęěεέеэⓔ",
+	"f":    "ƒφфⓕ",
+	"g":    "ĝğġģγгґⓖ",
+	"h":    "ĥħⓗ",
+	"i":    "ìíîïĩīĭįıǐιίϊΐηήиіⓘ",
+	"j":    "ĵйⓙ",
+	"k":    "ķκкⓚ",
+	"l":    "ĺļľŀłλлⓛ",
+	"m":    "μмⓜ",
+	"n":    "ñńņňŉνнⓝ",
+	"o":    "òóôõöøōŏőǒοόωώоⓞ",
+	"p":    "πпⓟ",
+	"r":    "ŕŗřρрⓡ",
+	"s":    "śŝşšșσςсⓢ",
+	"t":    "ţťŧțτтⓣ",
+	"u":    "ùúûüũūŭůűųǔуⓤ",
+	"v":    "вⓥ",
+	"w":    "ŵⓦ",
+	"x":    "ξⓧ",
+	"y":    "ýÿŷυύыⓨ",
+	"z":    "źżžζзⓩ",
+	"ae":   "æǽ",
+	"oe":   "œ",
+	"ss":   "ß",
+	"th":   "þθ",
+	"ch":   "χч",
+	"ps":   "ψ",
+	"ts":   "ц",
+	"sh":   "ш",
+	"zh":   "ж",
+	"kh":   "х",
+	"ye":   "є",
+	"yi":   "ї",
+	"yo":   "ё",
+	"yu":   "ю",
+	"ya":   "я",
+	"shch": "щ",
+	"":     "ъь",
+}
+
+// transliterations maps each letter in letters to its ASCII spelling
+var transliterations = map[rune]string{}
+
+func init() {
+	for spelling, written := range letters {
+		for _, letter := range written {
+			transliterations[letter] = spelling
+		}
+	}
+}
+
+// Make turns text into a slug: lower case ASCII letters and digits, with single dashes between words.
+// Letters from other alphabets are transliterated where possible and dropped otherwise, so the slug can
+// come out empty.
+func Make(text string) string {
+	var ascii strings.Builder
+	for _, letter := range strings.ToLower(text) {
+		if spelling, ok := transliterations[letter]; ok {
+			ascii.WriteString(spelling)
+			continue
+		}
+		ascii.WriteRune(letter)
+	}
+
+	var slug strings.Builder
+	dash := false
+	for _, letter := range ascii.String() {
+		switch {
+		case letter >= 'a' && letter <= 'z', letter >= '0' && letter <= '9':
+			if dash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			dash = false
+			slug.WriteRune(letter)
+		case letter == '\'' || letter == '’':
+			// Apostrophes join words: "don't" is dont, not don-t
+		default:
+			dash = true
+		}
+	}
+	return truncate(slug.String())
+}
+
+// truncate cuts slug to maxLength at the last dash before it, so no word is cut in half
+func truncate(slug string) string {
+	if len(slug) <= maxLength {
+		return slug
+	}
+	slug = slug[:maxLength+1]
+	if i := strings.LastIndexByte(slug, '-'); i > 0 {
+		return slug[:i]
+	}
+	return slug[:maxLength]
+}
@@ -0,0 +1,59 @@
+package slugs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"words", "Introduction to Go", "introduction-to-go"},
+		{"punctuation and spaces", "  Go:   the -- Good Parts!  ", "go-the-good-parts"},
+		{"digits", "Calculus 2nd Edition 2021", "calculus-2nd-edition-2021"},
+		{"apostrophes join words", "Don't Panic, It’s Fine", "dont-panic-its-fine"},
+		{"accents", "Café Crème Brûlée", "cafe-creme-brulee"},
+		{"ligatures", "Æsop's Œuvre Straße", "aesops-oeuvre-strasse"},
+		{"greek", "Θεωρία", "theoria"},
+		{"cyrillic", "Щука и ёж", "shchuka-i-yozh"},
+		{"signs are dropped", "объект", "obekt"},
+		{"nothing to make a slug from", "日本語", ""},
+		{"empty", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Make(test.text); got != test.want {
+				t.Errorf("Make(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMakeTruncates(t *testing.T) {
+	word := strings.Repeat("a", 9)
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"short enough", strings.Repeat(word+" ", 8), strings.TrimSuffix(strings.Repeat(word+"-", 8), "-")},
+		{"cut at a dash", strings.Repeat(word+" ", 10), strings.TrimSuffix(strings.Repeat(word+"-", 8), "-")},
+		{"one long word", strings.Repeat("b", maxLength+20), strings.Repeat("b", maxLength)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Make(test.text)
+			if got != test.want {
+				t.Errorf("Make() = %q, want %q", got, test.want)
+			}
+			if len(got) > maxLength {
+				t.Errorf("len(Make()) = %d, longer than %d", len(got), maxLength)
+			}
+		})
+	}
+}
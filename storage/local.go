@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"bookateriago/core"
+	"bookateriago/log"
+	"bookateriago/metrics"
+	"bookateriago/tracing"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/label"
+)
+
+// Local keeps objects on the local filesystem. Meant for development and tests,
+// where there are no AWS credentials around.
+// Local is also the http.Handler serving and receiving the files, but only through signed URLs.
+type Local struct {
+	// Root is the directory objects are written to
+	Root string
+	// BaseURL is the prefix the Root directory is served under
+	BaseURL string
+	secret  []byte
+}
+
+// NewLocal creates a local backend rooted at the root directory.
+// secret is used for signing download and upload URLs.
+func NewLocal(root, baseURL, secret string) *Local {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	return &Local{Root: root, BaseURL: baseURL, secret: []byte(secret)}
+}
+
+// path maps a key to a file inside Root. Cleaning it as an absolute path first
+// makes sure keys like ../../etc/passwd can't escape the root directory.
+func (l *Local) path(key string) string {
+	return filepath.Join(l.Root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// Put writes body to the file for key, creating directories as needed.
+// The file is written under a temporary name first so readers never see half an upload.
+func (l *Local) Put(ctx context.Context, key string, body io.Reader, _ string) (err error) {
+	body, done := metrics.TrackUpload("local", body)
+	_, span := tracing.Child(ctx, "storage put", label.String("storage.driver", "local"), label.String("storage.key", key))
+	defer func() {
+		done(err)
+		tracing.End(span, err)
+	}()
+
+	filePath := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err = io.Copy(file, body); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filePath)
+}
+
+// Get opens the file for key
+func (l *Local) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	file, err := os.Open(l.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// Delete removes the file for key
+func (l *Local) Delete(_ context.Context, key string) error {
+	err := os.Remove(l.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Stat returns the size, type and modification time of the file for key.
+// The ETag is the hex MD5 of the content, the same as S3 gives for objects uploaded in one go.
+func (l *Local) Stat(_ context.Context, key string) (ObjectInfo, error) {
+	file, err := os.Open(l.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	hash := md5.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  mime.TypeByExtension(filepath.Ext(key)),
+		ETag:         hex.EncodeToString(hash.Sum(nil)),
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+// URL is the key under BaseURL
+func (l *Local) URL(key string) string {
+	return l.BaseURL + l.clean(key)
+}
+
+// SignedURL is URL with an expiry time and a signature over both the key and the expiry
+func (l *Local) SignedURL(_ context.Context, key string, expiry time.Duration) (string, error) {
+	return l.signedURL(http.MethodGet, key, "", expiry), nil
+}
+
+// SignedUploadURL is a signed URL the file can be PUT to, with the Content-MD5 header set to contentMD5
+func (l *Local) SignedUploadURL(_ context.Context, key, _, contentMD5 string, expiry time.Duration) (string, error) {
+	return l.signedURL(http.MethodPut, key, contentMD5, expiry), nil
+}
+
+// ServeHTTP serves downloads and takes uploads, as long as the URL was signed for the request method
+// and hasn't expired. Mount it under BaseURL with the prefix stripped.
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := l.clean(r.URL.Path)
+	contentMD5 := r.Header.Get("Content-MD5")
+	if r.Method != http.MethodPut {
+		contentMD5 = ""
+	}
+
+	expires := r.URL.Query().Get("expires")
+	signature := r.URL.Query().Get("signature")
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt ||
+		!hmac.Equal([]byte(signature), []byte(l.sign(r.Method, key, contentMD5, expires))) {
+		core.WriteProblem(w, r, core.FourOThree)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		http.ServeFile(w, r, l.path(key))
+	case http.MethodPut:
+		limit := MaxUploadSize()
+		if r.ContentLength > limit {
+			core.WriteProblem(w, r, core.FourThirteen)
+			return
+		}
+		// Check the content against the signed MD5 on the way in, like S3 does. Put only replaces
+		// what's stored under key once the whole body is in and matches.
+		body := &checkedBody{body: http.MaxBytesReader(w, r.Body, limit), hash: md5.New(), want: contentMD5}
+		err = l.Put(r.Context(), key, body, r.Header.Get("Content-Type"))
+		switch {
+		case errors.Is(err, errChecksum):
+			core.WriteProblem(w, r, core.FourHundred, core.Field("Content-MD5", "mismatch"))
+			return
+		case err != nil && body.size >= limit:
+			// MaxBytesReader stops exactly at the limit
+			core.WriteProblem(w, r, core.FourThirteen)
+			return
+		case err != nil:
+			log.ErrorContext(r.Context(), err)
+			core.WriteProblem(w, r, core.FiveHundred)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		core.WriteProblem(w, r, core.FourOFive)
+	}
+}
+
+// signedURL signs a request of the given method for key
+func (l *Local) signedURL(method, key, contentMD5 string, expiry time.Duration) string {
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", l.sign(method, l.clean(key), contentMD5, expires))
+	return l.URL(key) + "?" + query.Encode()
+}
+
+// clean normalizes a key so the same file always has the same signature
+func (l *Local) clean(key string) string {
+	return strings.TrimPrefix(path.Clean("/"+key), "/")
+}
+
+// sign is the hex HMAC-SHA256 of everything a signed URL is valid for
+func (l *Local) sign(method, key, contentMD5, expires string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(strings.Join([]string{method, key, contentMD5, expires}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// errChecksum is what checkedBody fails with when the body doesn't have the MD5 it was signed for
+var errChecksum = errors.New("storage: body does not match Content-MD5")
+
+// checkedBody hashes body as it is read, and fails at the end instead of reporting EOF when the MD5 is
+// not the one wanted, so Put never keeps the file
+type checkedBody struct {
+	body io.Reader
+	hash hash.Hash
+	want string
+	size int64
+}
+
+func (c *checkedBody) Read(p []byte) (int, error) {
+	n, err := c.body.Read(p)
+	c.hash.Write(p[:n])
+	c.size += int64(n)
+	if err == io.EOF && base64.StdEncoding.EncodeToString(c.hash.Sum(nil)) != c.want {
+		return n, errChecksum
+	}
+	return n, err
+}
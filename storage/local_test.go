@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// request sends a request for the signed URL to local, mounted the way main does it
+func request(local *Local, method, signed, body, contentMD5 string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, signed, strings.NewReader(body))
+	if contentMD5 != "" {
+		r.Header.Set("Content-MD5", contentMD5)
+	}
+	w := httptest.NewRecorder()
+	http.StripPrefix(local.BaseURL, local).ServeHTTP(w, r)
+	return w
+}
+
+func checksum(body string) string {
+	sum := md5.Sum([]byte(body))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestLocalSignedURLs(t *testing.T) {
+	ctx := context.Background()
+	local := NewLocal(t.TempDir(), "/media", "secret")
+	body := "The Go Programming Language"
+	upload, _ := local.SignedUploadURL(ctx, "books/go.pdf", "application/pdf", checksum(body), time.Minute)
+	download, _ := local.SignedURL(ctx, "books/go.pdf", time.Minute)
+	expired, _ := local.SignedURL(ctx, "books/go.pdf", -time.Minute)
+	tampered := strings.Replace(download, "go.pdf", "other.pdf", 1)
+	otherSecret, _ := NewLocal(local.Root, "/media", "other").SignedURL(ctx, "books/go.pdf", time.Minute)
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		contentMD5 string
+		status     int
+	}{
+		{"download before the upload", http.MethodGet, download, "", "", http.StatusNotFound},
+		{"upload with the wrong checksum", http.MethodPut, upload, body, checksum("something else"), http.StatusForbidden},
+		{"upload of other content", http.MethodPut, upload, "something else", checksum(body), http.StatusBadRequest},
+		{"upload", http.MethodPut, upload, body, checksum(body), http.StatusOK},
+		{"download", http.MethodGet, download, "", "", http.StatusOK},
+		{"upload of other content over it", http.MethodPut, upload, "something else", checksum(body), http.StatusBadRequest},
+		{"download after the refused upload", http.MethodGet, download, "", "", http.StatusOK},
+		{"download link used to upload", http.MethodPut, download, body, checksum(body), http.StatusForbidden},
+		{"upload link used to download", http.MethodGet, upload, "", "", http.StatusForbidden},
+		{"expired", http.MethodGet, expired, "", "", http.StatusForbidden},
+		{"other key", http.MethodGet, tampered, "", "", http.StatusForbidden},
+		{"other secret", http.MethodGet, otherSecret, "", "", http.StatusForbidden},
+		{"unsigned", http.MethodGet, local.URL("books/go.pdf"), "", "", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := request(local, test.method, test.url, test.body, test.contentMD5)
+			if w.Code != test.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+			if test.method == http.MethodGet && w.Code == http.StatusOK && w.Body.String() != body {
+				t.Errorf("downloaded %q, want %q", w.Body, body)
+			}
+		})
+	}
+}
+
+func TestLocalUploadTooLarge(t *testing.T) {
+	local := NewLocal(t.TempDir(), "/media", "secret")
+	upload, _ := local.SignedUploadURL(context.Background(), "books/go.pdf", "application/pdf", checksum(""), time.Minute)
+
+	r := httptest.NewRequest(http.MethodPut, upload, nil)
+	r.ContentLength = MaxUploadSize() + 1
+	r.Header.Set("Content-MD5", checksum(""))
+	w := httptest.NewRecorder()
+	http.StripPrefix(local.BaseURL, local).ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want %d: %s", w.Code, http.StatusRequestEntityTooLarge, w.Body)
+	}
+}
+
+func TestLocalKeys(t *testing.T) {
+	ctx := context.Background()
+	local := NewLocal(t.TempDir(), "/media/", "secret")
+	if err := local.Put(ctx, "../../outside.txt", strings.NewReader("contained"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(local.Root, "outside.txt")); err != nil {
+		t.Errorf("a key with .. wasn't kept inside the root: %v", err)
+	}
+
+	file, err := local.Get(ctx, "outside.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadAll(file)
+	file.Close()
+	if string(content) != "contained" {
+		t.Errorf("Get() read %q, want contained", content)
+	}
+
+	info, err := local.Stat(ctx, "/outside.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len("contained")) || info.ContentType != "text/plain; charset=utf-8" ||
+		info.ETag != "645f0a909a74900ccac2dcbb18ccb79c" {
+		t.Errorf("Stat() = %+v", info)
+	}
+	if _, err := local.Stat(ctx, "missing.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat() of a missing key returned %v, want ErrNotFound", err)
+	}
+	if _, err := local.Get(ctx, "missing.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a missing key returned %v, want ErrNotFound", err)
+	}
+	if err := local.Delete(ctx, "outside.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Delete(ctx, "missing.txt"); err != nil {
+		t.Errorf("Delete() of a missing key returned %v", err)
+	}
+
+	if url := local.URL("a/./b/../c.txt"); url != "/media/a/c.txt" {
+		t.Errorf("URL() = %s, want /media/a/c.txt", url)
+	}
+}
+
+func TestUploadErrorStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{ErrUploadNotFound, http.StatusNotFound},
+		{ErrUploadIncomplete, http.StatusConflict},
+		{ErrUploadInvalid, http.StatusUnprocessableEntity},
+		{ErrUploadMismatch, http.StatusUnprocessableEntity},
+		{errors.New("redis is down"), http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		if status := UploadErrorStatus(test.err); status != test.status {
+			t.Errorf("UploadErrorStatus(%v) = %d, want %d", test.err, status, test.status)
+		}
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	first, err := NewKey("submissions/essay", "../My Essay (final).pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := NewKey("submissions/essay", "../My Essay (final).pdf")
+	if first == second {
+		t.Errorf("NewKey() gave %s twice", first)
+	}
+	if path.Dir(path.Dir(first)) != "submissions/essay" || path.Base(first) != "My-Essay-final-.pdf" {
+		t.Errorf("NewKey() = %s", first)
+	}
+	if _, err := NewKey("submissions/essay", ""); !errors.Is(err, ErrUploadInvalid) {
+		t.Errorf("NewKey() without a name returned %v, want ErrUploadInvalid", err)
+	}
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"bookateriago/metrics"
+	"bookateriago/tracing"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"go.opentelemetry.io/otel/label"
+)
+
+// S3 stores objects in an AWS S3 bucket, or any S3 compatible server such as MinIO
+type S3 struct {
+	bucket   string
+	endpoint string
+	client   *s3.S3
+	uploader *s3manager.Uploader
+}
+
+// NewS3 connects to S3 with the given credentials. Pass an empty endpoint for AWS itself.
+// A custom endpoint (MinIO and friends) is addressed path style, i.e. endpoint/bucket/key.
+func NewS3(accessKeyID, secretAccessKey, region, bucket, endpoint string) (*S3, error) {
+	config := &aws.Config{
+		Credentials: credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
+		Region:      aws.String(region),
+	}
+	if endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3{
+		bucket:   bucket,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   s3.New(sess),
+		uploader: s3manager.NewUploader(sess),
+	}, nil
+}
+
+// Put uploads body to the bucket. Large bodies are sent in parts.
+func (s *S3) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	// No ACL, so the object is as private as the bucket. Downloads go through SignedURL.
+	body, done := metrics.TrackUpload("s3", body)
+	ctx, span := tracing.Child(ctx, "storage put", label.String("storage.driver", "s3"), label.String("storage.key", key))
+	input := &s3manager.UploadInput{
+		Body:   body,
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	_, err := s.uploader.UploadWithContext(ctx, input)
+	done(err)
+	tracing.End(span, err)
+	return err
+}
+
+// Get downloads the object
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	output, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return output.Body, nil
+}
+
+// Delete removes the object from the bucket
+func (s *S3) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// Stat reads the object metadata without downloading it
+func (s *S3) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	output, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return ObjectInfo{}, notFound(err)
+	}
+
+	return ObjectInfo{
+		Key:          key,
+		Size:         aws.Int64Value(output.ContentLength),
+		ContentType:  aws.StringValue(output.ContentType),
+		ETag:         strings.Trim(aws.StringValue(output.ETag), `"`),
+		LastModified: aws.TimeValue(output.LastModified),
+	}, nil
+}
+
+// URL is the public address of the object
+func (s *S3) URL(key string) string {
+	if s.endpoint != "" {
+		return s.endpoint + "/" + s.bucket + "/" + key
+	}
+	return "https://" + s.bucket + ".s3.amazonaws.com/" + key
+}
+
+// SignedURL presigns a GET request for the object
+func (s *S3) SignedURL(_ context.Context, key string, expiry time.Duration) (string, error) {
+	request, _ := s.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return request.Presign(expiry)
+}
+
+// SignedUploadURL presigns a PUT request for the object. The client has to send the same
+// Content-Type and Content-MD5 headers, and S3 rejects the upload if the content doesn't match the MD5.
+func (s *S3) SignedUploadURL(_ context.Context, key, contentType, contentMD5 string, expiry time.Duration) (string, error) {
+	request, _ := s.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+		ContentMD5:  aws.String(contentMD5),
+	})
+	return request.Presign(expiry)
+}
+
+// notFound turns the S3 missing object errors into ErrNotFound
+func notFound(err error) error {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return ErrNotFound
+		}
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"bookateriago/config"
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned by every backend when the requested object doesn't exist
+var ErrNotFound = errors.New("storage: object not found")
+
+// ObjectInfo is the metadata of a stored object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// Storage is implemented by everything files can be uploaded to.
+// Keys are slash separated paths relative to the root of the backend, e.g. media/file/book.pdf
+type Storage interface {
+	// Put stores everything read from body under key, replacing whatever was there
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	// Get opens the object for reading. The caller has to close it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object. Deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// Stat returns the object metadata or ErrNotFound
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// URL is the unsigned address of the object. Objects are private, so this only works
+	// for buckets or directories that have been made public on purpose
+	URL(key string) string
+	// SignedURL is an address anyone can download the object from until expiry runs out
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// SignedUploadURL is an address the object can be uploaded to with a PUT request until expiry runs out.
+	// The request has to carry the given Content-Type and Content-MD5 (base64) headers.
+	SignedUploadURL(ctx context.Context, key, contentType, contentMD5 string, expiry time.Duration) (string, error)
+}
+
+// New builds the backend configured by storage.driver: "local", "s3" or "minio".
+// S3 is used if nothing is set, so existing deployments keep working.
+//
+//	local: storage.root and storage.baseURL. Download links are signed with settings.key
+//	s3: aws.accessKeyID, aws.secretAccessKey, aws.region and aws.bucket
+//	minio: same as s3 plus storage.endpoint, for any other S3 compatible server
+func New(settings *config.Config) (Storage, error) {
+	aws := settings.AWS
+
+	switch settings.Storage.Driver {
+	case "local":
+		return NewLocal(settings.Storage.Root, settings.Storage.BaseURL, settings.Settings.Key), nil
+	case "minio":
+		return NewS3(aws.AccessKeyID, aws.SecretAccessKey, aws.Region, aws.Bucket, settings.Storage.Endpoint)
+	default:
+		return NewS3(aws.AccessKeyID, aws.SecretAccessKey, aws.Region, aws.Bucket, "")
+	}
+}
+
+// URLExpiry is how long signed download links stay valid. Set with storage.urlExpiry, 15 minutes by default.
+func URLExpiry() time.Duration {
+	return config.Get().Storage.URLExpiry
+}
@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"bookateriago/config"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// slotGrace is how long a slot outlives its link, so an upload that finishes right at the end can still be finalized
+const slotGrace = time.Hour
+
+var (
+	// ErrUploadNotFound is returned when an upload slot doesn't exist, has expired or belongs to someone else
+	ErrUploadNotFound = errors.New("storage: upload not found")
+	// ErrUploadIncomplete is returned when the file hasn't been uploaded to the slot yet
+	ErrUploadIncomplete = errors.New("storage: file not uploaded yet")
+	// ErrUploadMismatch is returned when the uploaded file isn't the size or checksum promised
+	ErrUploadMismatch = errors.New("storage: uploaded file does not match")
+	// ErrUploadInvalid is returned when an upload slot is requested with a bad size or checksum
+	ErrUploadInvalid = errors.New("storage: invalid upload request")
+
+	fileNameRegex = regexp.MustCompile("[^a-zA-Z0-9._-]+")
+
+	// claim gets an upload slot and deletes it in one step, like GETDEL, so only one caller can finish it
+	claim = redis.NewScript(`
+local slot = redis.call("GET", KEYS[1])
+if slot then
+	redis.call("DEL", KEYS[1])
+end
+return slot
+`)
+)
+
+// Uploads hands out slots for uploading files straight to a backend, and keeps track of them in Redis
+type Uploads struct {
+	store  Storage
+	client *redis.Client
+}
+
+// NewUploads hands out slots for uploading to store, kept track of in client
+func NewUploads(store Storage, client *redis.Client) *Uploads {
+	return &Uploads{store: store, client: client}
+}
+
+// UploadRequest is what a client sends when asking for an upload slot
+type UploadRequest struct {
+	FileName    string `json:"file_name" validate:"required,max=255"`
+	Size        int64  `json:"size" validate:"required,min=1"`
+	ContentType string `json:"content_type" validate:"max=255"`
+	// Checksum is the base64 encoded MD5 of the file, as sent in a Content-MD5 header
+	Checksum string `json:"checksum" validate:"required"`
+}
+
+// Upload is a slot a client uploads a file to directly, without going through the API server.
+// It is kept in redis until it is finished or expires.
+type Upload struct {
+	ID          string `json:"id"`
+	Key         string `json:"key"`
+	FileName    string `json:"file_name"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	Checksum    string `json:"checksum"`
+	Owner       string `json:"owner"`
+	// Prefix is what the slot was requested for, like the question of a submission
+	Prefix    string    `json:"prefix"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// UploadSlot is returned to the client. The file has to be sent to URL with Method and Headers.
+type UploadSlot struct {
+	Upload
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+}
+
+// MaxUploadSize is the largest file a slot is handed out for. Set in bytes with storage.maxUploadSize,
+// 100MB by default.
+func MaxUploadSize() int64 {
+	return config.Get().Storage.MaxUploadSize
+}
+
+// NewKey is a key under prefix for a file called fileName, in a directory of its own so it never replaces
+// another file. It returns ErrUploadInvalid when nothing usable is left of fileName.
+func NewKey(prefix, fileName string) (string, error) {
+	fileName, ok := cleanFileName(fileName)
+	if !ok {
+		return "", ErrUploadInvalid
+	}
+	id, err := randomID()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(prefix, id, fileName), nil
+}
+
+// cleanFileName is the last part of name, with anything that isn't safe in a key replaced
+func cleanFileName(name string) (string, bool) {
+	fileName := fileNameRegex.ReplaceAllString(path.Base(name), "-")
+	return fileName, fileName != "" && fileName != "." && fileName != "/"
+}
+
+// randomID is a hex encoded random id, for slots and the directories their files go in
+func randomID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// NewUpload hands out a slot for uploading the described file under prefix, for owner only.
+func (u *Uploads) NewUpload(ctx context.Context, owner, prefix string, request UploadRequest) (UploadSlot, error) {
+	checksum, err := base64.StdEncoding.DecodeString(request.Checksum)
+	if err != nil || len(checksum) != 16 || request.Size <= 0 || request.Size > MaxUploadSize() {
+		return UploadSlot{}, ErrUploadInvalid
+	}
+	fileName, ok := cleanFileName(request.FileName)
+	if !ok {
+		return UploadSlot{}, ErrUploadInvalid
+	}
+	if request.ContentType == "" {
+		request.ContentType = "application/octet-stream"
+	}
+
+	id, err := randomID()
+	if err != nil {
+		return UploadSlot{}, err
+	}
+
+	expiry := URLExpiry()
+	upload := Upload{
+		ID:          id,
+		FileName:    fileName,
+		Size:        request.Size,
+		ContentType: request.ContentType,
+		Checksum:    request.Checksum,
+		Owner:       owner,
+		Prefix:      prefix,
+		ExpiresAt:   time.Now().Add(expiry),
+	}
+	upload.Key = path.Join(prefix, upload.ID, fileName)
+
+	url, err := u.store.SignedUploadURL(ctx, upload.Key, upload.ContentType, upload.Checksum, expiry)
+	if err != nil {
+		return UploadSlot{}, err
+	}
+
+	stored, err := json.Marshal(upload)
+	if err != nil {
+		return UploadSlot{}, err
+	}
+	err = u.client.Set(ctx, uploadKey(upload.ID), stored, expiry+slotGrace).Err()
+	if err != nil {
+		return UploadSlot{}, err
+	}
+
+	return UploadSlot{
+		Upload: upload,
+		URL:    url,
+		Method: http.MethodPut,
+		Headers: map[string]string{
+			"Content-Type": upload.ContentType,
+			"Content-MD5":  upload.Checksum,
+		},
+	}, nil
+}
+
+// FinishUpload checks that the file for the slot owner requested under prefix was uploaded, and is exactly
+// the size and checksum that was asked for. The slot is claimed first, so when the same slot is finished
+// twice at once only one call succeeds. It is used up unless the file isn't there yet, and if the file
+// doesn't match it is deleted.
+func (u *Uploads) FinishUpload(ctx context.Context, owner, prefix, id string) (Upload, error) {
+	stored, err := claim.Run(ctx, u.client, []string{uploadKey(id)}).Text()
+	if errors.Is(err, redis.Nil) {
+		return Upload{}, ErrUploadNotFound
+	}
+	if err != nil {
+		return Upload{}, err
+	}
+
+	var upload Upload
+	if err = json.Unmarshal([]byte(stored), &upload); err != nil {
+		return Upload{}, err
+	}
+	if upload.Owner != owner || upload.Prefix != prefix {
+		// Not the caller's to finish, it stays for whoever it belongs to
+		return Upload{}, u.release(ctx, upload, stored, ErrUploadNotFound)
+	}
+
+	info, err := u.store.Stat(ctx, upload.Key)
+	if errors.Is(err, ErrNotFound) {
+		return Upload{}, u.release(ctx, upload, stored, ErrUploadIncomplete)
+	}
+	if err != nil {
+		return Upload{}, u.release(ctx, upload, stored, err)
+	}
+
+	checksum, _ := base64.StdEncoding.DecodeString(upload.Checksum)
+	if info.Size != upload.Size || info.ETag != hex.EncodeToString(checksum) {
+		_ = u.store.Delete(ctx, upload.Key)
+		return Upload{}, ErrUploadMismatch
+	}
+	return upload, nil
+}
+
+// release puts a claimed slot back for as long as it had left, so it can be finished later, and returns err
+func (u *Uploads) release(ctx context.Context, upload Upload, stored string, err error) error {
+	remaining := time.Until(upload.ExpiresAt.Add(slotGrace))
+	if remaining <= 0 {
+		return err
+	}
+	if setErr := u.client.Set(ctx, uploadKey(upload.ID), stored, remaining).Err(); setErr != nil {
+		return setErr
+	}
+	return err
+}
+
+// uploadKey is the redis key an upload slot is stored under
+func uploadKey(id string) string {
+	return fmt.Sprintf("upload_slot_%s", id)
+}
+
+// UploadErrorStatus is the HTTP status code to respond with for an error from NewUpload or FinishUpload
+func UploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUploadNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrUploadIncomplete):
+		return http.StatusConflict
+	case errors.Is(err, ErrUploadInvalid), errors.Is(err, ErrUploadMismatch):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/semconv"
+	"gorm.io/gorm"
+)
+
+// spanKey holds the span of a query in the gorm statement
+const spanKey = "tracing:span"
+
+// Database is a gorm plugin giving every query a span. Add it with db.Use(tracing.Database{}).
+// Queries are only traced when they run with the context of a traced request, via db.WithContext.
+type Database struct{}
+
+// Name identifies the plugin to gorm
+func (Database) Name() string {
+	return "tracing"
+}
+
+// Initialize registers the callbacks around each kind of query
+func (Database) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	processors := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", callbacks.Create().Before("gorm:create").Register, callbacks.Create().After("gorm:create").Register},
+		{"query", callbacks.Query().Before("gorm:query").Register, callbacks.Query().After("gorm:query").Register},
+		{"update", callbacks.Update().Before("gorm:update").Register, callbacks.Update().After("gorm:update").Register},
+		{"delete", callbacks.Delete().Before("gorm:delete").Register, callbacks.Delete().After("gorm:delete").Register},
+		{"row", callbacks.Row().Before("gorm:row").Register, callbacks.Row().After("gorm:row").Register},
+		{"raw", callbacks.Raw().Before("gorm:raw").Register, callbacks.Raw().After("gorm:raw").Register},
+	}
+
+	for _, processor := range processors {
+		operation := processor.operation
+		if err := processor.before("tracing:before_"+operation, func(db *gorm.DB) {
+			startQuery(db, operation)
+		}); err != nil {
+			return err
+		}
+		if err := processor.after("tracing:after_"+operation, endQuery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startQuery(db *gorm.DB, operation string) {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		return
+	}
+	name := operation
+	if db.Statement.Table != "" {
+		name += " " + db.Statement.Table
+	}
+	_, span := Child(ctx, "db "+name,
+		semconv.DBSystemPostgres,
+		semconv.DBOperationKey.String(operation),
+		label.String("db.sql.table", db.Statement.Table),
+	)
+	db.InstanceSet(spanKey, span)
+}
+
+func endQuery(db *gorm.DB) {
+	value, ok := db.InstanceGet(spanKey)
+	span, isSpan := value.(trace.Span)
+	if !ok || !isSpan {
+		return
+	}
+	// The statement is only built once the query ran. Its values stay out, they can be personal data.
+	if sql := db.Statement.SQL.String(); sql != "" {
+		span.SetAttributes(semconv.DBStatementKey.String(sql))
+	}
+	span.SetAttributes(label.Int64("db.rows_affected", db.Statement.RowsAffected))
+	err := db.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	End(span, err)
+}
+
+// Redis is a go-redis hook giving every command a span. Add it with client.AddHook(tracing.Redis{}).
+// Like queries, commands are only traced in a traced request.
+type Redis struct{}
+
+// BeforeProcess starts the span of the command
+func (Redis) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, _ = Child(ctx, "redis "+strings.ToUpper(cmd.Name()),
+		semconv.DBSystemRedis,
+		semconv.DBOperationKey.String(cmd.Name()),
+	)
+	return ctx, nil
+}
+
+// AfterProcess ends the span of the command
+func (Redis) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	endRedis(ctx, cmd.Err())
+	return nil
+}
+
+// BeforeProcessPipeline starts one span for the whole pipeline
+func (Redis) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name()
+	}
+	ctx, _ = Child(ctx, "redis pipeline",
+		semconv.DBSystemRedis,
+		semconv.DBOperationKey.String(strings.Join(names, " ")),
+	)
+	return ctx, nil
+}
+
+// AfterProcessPipeline ends the span of the pipeline, failed if any command in it failed
+func (Redis) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && cmd.Err() != redis.Nil {
+			err = cmd.Err()
+			break
+		}
+	}
+	endRedis(ctx, err)
+	return nil
+}
+
+// endRedis ends the span started before the command, if there is one. Missing keys aren't failures.
+func endRedis(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	if err == redis.Nil {
+		err = nil
+	}
+	End(span, err)
+}
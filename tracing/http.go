@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"bookateriago/log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/semconv"
+)
+
+// statusRecorder notes the status a handler answers with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+// Flush lets streaming handlers flush through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Middleware starts the span of a request, continuing the trace of the caller when the traceparent header
+// names one. The trace ID goes in the log scope, so log entries can be matched with traces. It wraps the
+// whole router, inside log.Middleware, so requests that match no route are traced too.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := global.TextMapPropagator().Extract(r.Context(), r.Header)
+		ctx, span := global.Tracer(instrumentation).Start(ctx, "HTTP "+r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("bookateria", "", r)...),
+			trace.WithAttributes(semconv.NetAttributesFromHTTPRequest("tcp", r)...),
+		)
+		defer span.End()
+		if spanContext := span.SpanContext(); spanContext.IsValid() {
+			log.AddFields(ctx, log.Fields{"trace_id": spanContext.TraceID.String()})
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(recorder.status)...)
+		// Client errors are the client's, only server errors fail the span
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+// Route names the span of a request after the template of the route it matched, e.g.
+// GET /v1/forum/question/{slug}. It is a router middleware, as routes are only known once one matched.
+func Route(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Method + " " + template)
+				span.SetAttributes(semconv.HTTPRouteKey.String(template))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,113 @@
+// Package tracing records OpenTelemetry traces of requests, with spans for the database, Redis, storage
+// and email work done for them. Trace context comes in and goes out in the W3C traceparent header.
+package tracing
+
+import (
+	"bookateriago/config"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/stdout"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/propagators"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"google.golang.org/grpc/credentials"
+)
+
+// instrumentation names the tracer every span of the application comes from
+const instrumentation = "bookateriago"
+
+// closeTimeout is how long Close waits for the last spans to be exported
+const closeTimeout = 5 * time.Second
+
+var (
+	provider  *sdktrace.TracerProvider
+	processor *sdktrace.BatchSpanProcessor
+	exporter  export.SpanExporter
+)
+
+// Setup starts exporting traces as the settings say, to an OTLP collector or to stdout. It is meant to run
+// once at startup. Whether tracing is on or not, incoming trace context is picked up and passed on.
+func Setup(settings config.TracingConfig) error {
+	global.SetTextMapPropagator(otel.NewCompositeTextMapPropagator(propagators.TraceContext{}, propagators.Baggage{}))
+	if !settings.Enabled {
+		return nil
+	}
+
+	var err error
+	switch settings.Exporter {
+	case "stdout":
+		exporter, err = stdout.NewExporter(stdout.WithWriter(os.Stdout), stdout.WithoutMetricExport())
+	default:
+		options := []otlp.ExporterOption{otlp.WithAddress(settings.Endpoint)}
+		if settings.Insecure {
+			options = append(options, otlp.WithInsecure())
+		} else {
+			// Checked against the system certificates
+			options = append(options, otlp.WithTLSCredentials(credentials.NewClientTLSFromCert(nil, "")))
+		}
+		exporter, err = otlp.NewExporter(options...)
+	}
+	if err != nil {
+		return fmt.Errorf("tracing: %w", err)
+	}
+
+	// Spans follow the sampling decision of the caller, so a trace is never cut in half
+	sampler := sdktrace.ParentBased(sdktrace.TraceIDRatioBased(settings.SampleRatio))
+	processor = sdktrace.NewBatchSpanProcessor(exporter)
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithConfig(sdktrace.Config{DefaultSampler: sampler}),
+		sdktrace.WithResource(resource.New(semconv.ServiceNameKey.String(settings.ServiceName))),
+		sdktrace.WithSpanProcessor(processor),
+	)
+	global.SetTracerProvider(provider)
+	return nil
+}
+
+// Close exports the spans still waiting and stops the exporter
+func Close() error {
+	if provider == nil {
+		return nil
+	}
+	// Unregistering the processor flushes it
+	provider.UnregisterSpanProcessor(processor)
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	err := exporter.Shutdown(ctx)
+	provider = nil
+	return err
+}
+
+// Start starts a span named name as a child of the one in ctx, if any. End the span it returns.
+func Start(ctx context.Context, name string, attributes ...label.KeyValue) (context.Context, trace.Span) {
+	return global.Tracer(instrumentation).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// Child starts the span of a call to the database, Redis or another service, but only when ctx is in a
+// trace. Work done outside of one, like the background jobs, would otherwise start a trace for every query.
+func Child(ctx context.Context, name string, attributes ...label.KeyValue) (context.Context, trace.Span) {
+	if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return global.Tracer(instrumentation).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+}
+
+// End ends span, marking it failed with err if there is one
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(context.Background(), err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}